@@ -0,0 +1,25 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/tls"
+	"fmt"
+)
+
+// AcquireCertificate is the single entry point for obtaining a certificate
+// for domains, signed with key: it runs the issuer chain, each issuer
+// building its own CSR (applying must-staple when that issuer requests
+// it) and falling through to the next issuer when one fails, while holding
+// Storage.Locker's lock for certKey so that when multiple ssl-cert-server
+// instances share one storage backend, only one of them performs the ACME
+// order for certKey at a time. A caller that waited for the lock then runs
+// the issuer chain itself; it does not read back a certificate that
+// another instance stored meanwhile.
+func AcquireCertificate(ctx context.Context, cfg *config, certKey string, key crypto.Signer, domains []string) (*tls.Certificate, error) {
+	tlscert, err := cfg.IssuerChain.IssueWithLock(ctx, cfg.Storage.Locker, certKey, key, domains)
+	if err != nil {
+		return nil, fmt.Errorf("acquire certificate for %q: %v", certKey, err)
+	}
+	return tlscert, nil
+}
@@ -3,11 +3,13 @@ package main
 import (
 	"context"
 	"flag"
+	"fmt"
 	"io/ioutil"
 	"log"
 	"regexp"
 	"strings"
 
+	"github.com/jxskiss/ssl-cert-server/server"
 	"golang.org/x/crypto/acme"
 	"golang.org/x/crypto/acme/autocert"
 	"gopkg.in/yaml.v2"
@@ -30,15 +32,27 @@ type config struct {
 	PIDFile string `yaml:"pid_file"` // default: "ssl-cert-server.pid"
 
 	Storage struct {
-		Type     string `yaml:"type"`      // dir_cache | redis, default: dir_cache
+		Type     string `yaml:"type"`      // dir_cache | redis | s3 | etcd, default: dir_cache
 		DirCache string `yaml:"dir_cache"` // default: "./secret-dir"
 		Redis    struct {
 			Addr string `yaml:"addr"` // default: "127.0.0.1:6379"
 		} `yaml:"redis"`
+		S3   S3Config   `yaml:"s3"`
+		Etcd EtcdConfig `yaml:"etcd"`
 
 		// Cache is used by Manager to store and retrieve previously obtained certificates
 		// and other account data as opaque blobs.
 		Cache autocert.Cache `yaml:"-"`
+
+		// Locker coordinates issuance across multiple instances sharing
+		// this storage backend. loadConfigFile sets it to Backend; for
+		// the s3 backend without lock_table it does no coordination.
+		Locker Locker `yaml:"-"`
+
+		// Backend is the generalized Storage implementation built from
+		// Type through the storage registry; StorageManager should use
+		// this rather than assuming an autocert.Cache.
+		Backend Storage `yaml:"-"`
 	} `yaml:"storage"`
 
 	Managed []struct {
@@ -50,12 +64,35 @@ type config struct {
 	} `yaml:"managed"`
 
 	LetsEncrypt struct {
-		Staging     bool     `yaml:"staging"`      // default: false
-		ForceRSA    bool     `yaml:"force_rsa"`    // default: false
-		RenewBefore int      `yaml:"renew_before"` // default: 30
-		Email       string   `yaml:"email"`
-		Domains     []string `yaml:"domains"`
-		REPatterns  []string `yaml:"re_patterns"`
+		Staging  bool `yaml:"staging"`   // default: false
+		ForceRSA bool `yaml:"force_rsa"` // default: false
+
+		// RenewBefore is deprecated in favor of RenewalWindowRatio; it
+		// is still accepted in conf.yaml and converted to an equivalent
+		// ratio (assuming a 90-day certificate lifetime) at load time,
+		// so existing configs keep working.
+		RenewBefore int `yaml:"renew_before"`
+
+		// RenewalWindowRatio is the fraction of a certificate's total
+		// lifetime, remaining before expiry, at which it is renewed:
+		// a cert is due for renewal once
+		//   time-until-expiry < RenewalWindowRatio * total-lifetime.
+		// This works for certificates of any lifetime, unlike a fixed
+		// day count, which is meaningless for short-lived certs (e.g.
+		// Let's Encrypt's 6-day or some internal CAs' 24h certs).
+		// Default: 1.0/3.
+		RenewalWindowRatio float64  `yaml:"renewal_window_ratio"`
+		Email              string   `yaml:"email"`
+		Domains            []string `yaml:"domains"`
+		REPatterns         []string `yaml:"re_patterns"`
+
+		// Wildcards lists wildcard names, which only the dns-01
+		// challenge can authorize (http-01 and tls-alpn-01 cannot).
+		// When non-empty, loadConfigFile builds DNSSolver from
+		// dns_challenge and hands it to the issuers. The entries
+		// themselves are not matched against requested hosts and do
+		// not choose which issuer handles a name.
+		Wildcards []string `yaml:"wildcards"`
 
 		// HostPolicy is built from DomainList and PatternList.
 		HostPolicy autocert.HostPolicy `yaml:"-"`
@@ -65,6 +102,24 @@ type config struct {
 		DirectoryURL string `yaml:"-"`
 	} `yaml:"lets_encrypt"`
 
+	// Issuers is an ordered list of certificate authorities to try when
+	// acquiring a certificate. When empty, the chain is synthesized from
+	// the LetsEncrypt block above for backwards compatibility: an
+	// autocert.Manager-backed issuer, followed by a dns-01 Let's Encrypt
+	// issuer when DNSSolver is set.
+	Issuers []IssuerConfig `yaml:"issuers"`
+
+	// IssuerChain is built from Issuers (or the legacy LetsEncrypt block).
+	IssuerChain IssuerChain `yaml:"-"`
+
+	// DNSChallenge configures the DNS-01 solver used to issue wildcard
+	// certificates (see LetsEncrypt.Wildcards).
+	DNSChallenge DNSChallengeConfig `yaml:"dns_challenge"`
+
+	// DNSSolver is built from DNSChallenge when LetsEncrypt.Wildcards is
+	// non-empty.
+	DNSSolver *dnsSolver `yaml:"-"`
+
 	SelfSigned struct {
 		Enable       bool     `yaml:"enable"`       // default: false
 		ValidDays    int      `yaml:"valid_days"`   // default: 365
@@ -75,43 +130,49 @@ type config struct {
 }
 
 func (p *config) setupDefaultOptions() {
-	if Cfg.Listen == "" {
-		Cfg.Listen = "127.0.0.1:8999"
+	if p.Listen == "" {
+		p.Listen = "127.0.0.1:8999"
 	}
-	if Cfg.PIDFile == "" {
-		Cfg.Listen = "ssl-cert-server.pid"
+	if p.PIDFile == "" {
+		p.PIDFile = "ssl-cert-server.pid"
 	}
 
-	if Cfg.Storage.Type == "" {
-		Cfg.Storage.Type = "dir_cache"
+	if p.Storage.Type == "" {
+		p.Storage.Type = "dir_cache"
 	}
-	if Cfg.Storage.DirCache == "" {
-		Cfg.Storage.DirCache = "./secret-dir"
+	if p.Storage.DirCache == "" {
+		p.Storage.DirCache = "./secret-dir"
 	}
-	if Cfg.Storage.Redis.Addr == "" {
-		Cfg.Storage.Redis.Addr = "127.0.0.1:6379"
+	if p.Storage.Redis.Addr == "" {
+		p.Storage.Redis.Addr = "127.0.0.1:6379"
 	}
 
-	if Cfg.LetsEncrypt.RenewBefore <= 0 {
-		Cfg.LetsEncrypt.RenewBefore = 30
+	if p.LetsEncrypt.RenewalWindowRatio <= 0 {
+		if p.LetsEncrypt.RenewBefore > 0 {
+			// Deprecated alias: convert the old fixed day count to an
+			// equivalent ratio, assuming the common 90-day lifetime.
+			p.LetsEncrypt.RenewalWindowRatio = float64(p.LetsEncrypt.RenewBefore) / 90
+		} else {
+			p.LetsEncrypt.RenewalWindowRatio = 1.0 / 3
+		}
 	}
-	if Cfg.LetsEncrypt.Staging {
-		Cfg.LetsEncrypt.DirectoryURL = stagingDirectoryURL
+	if p.LetsEncrypt.Staging {
+		p.LetsEncrypt.DirectoryURL = stagingDirectoryURL
 	} else {
-		Cfg.LetsEncrypt.DirectoryURL = acme.LetsEncryptURL
+		p.LetsEncrypt.DirectoryURL = acme.LetsEncryptURL
 	}
 
-	if Cfg.SelfSigned.ValidDays <= 0 {
-		Cfg.SelfSigned.ValidDays = 365
+	if p.SelfSigned.ValidDays <= 0 {
+		p.SelfSigned.ValidDays = 365
 	}
-	if len(Cfg.SelfSigned.Organization) == 0 {
-		Cfg.SelfSigned.Organization = defaultSelfSignedOrganization
+	if len(p.SelfSigned.Organization) == 0 {
+		p.SelfSigned.Organization = defaultSelfSignedOrganization
 	}
-	if Cfg.SelfSigned.Cert == "" {
-		Cfg.SelfSigned.Cert = "self_signed.cert"
+	if p.SelfSigned.Cert == "" {
+		p.SelfSigned.Cert = "self_signed.cert"
 	}
-	if Cfg.SelfSigned.PrivKey == "" {
-		Cfg.SelfSigned.PrivKey = "self_signed.key"
+	if p.SelfSigned.PrivKey == "" {
+		p.SelfSigned.PrivKey = "self_signed.key"
 	}
 }
 
@@ -158,8 +219,6 @@ func (p *config) buildHostPolicy() {
 	}
 }
 
-var Cfg = &config{}
-
 var Flags struct {
 	ShowVersion bool   // default: false
 	ConfigFile  string // default: "./conf.yaml"
@@ -171,37 +230,104 @@ func initFlags() {
 	flag.Parse()
 }
 
-func initConfig() {
-	confbuf, err := ioutil.ReadFile(Flags.ConfigFile)
+// loadConfigFile parses and fully prepares a *config from the YAML file at
+// path: defaults are filled in, host policy and managed-domain regexes are
+// compiled, and the issuer chain / storage backend / DNS solver are built.
+// It has no side effects on package globals, so it doubles as the builder
+// for both the initial load and each SIGHUP reload's shadow config.
+func loadConfigFile(path string) (*config, error) {
+	confbuf, err := ioutil.ReadFile(path)
 	if err != nil {
-		log.Fatalf("[FATAL] server: failed read configuration: %v", err)
+		return nil, fmt.Errorf("read configuration: %v", err)
 	}
-	err = yaml.UnmarshalStrict(confbuf, Cfg)
-	if err != nil {
-		log.Fatalf("[FATAL] server: failed read configuration: %v", err)
+	cfg := &config{}
+	if err := yaml.UnmarshalStrict(confbuf, cfg); err != nil {
+		return nil, fmt.Errorf("parse configuration: %v", err)
 	}
 
-	// Prepare configuration.
+	cfg.setupDefaultOptions()
+	for _, pattern := range cfg.LetsEncrypt.REPatterns {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return nil, fmt.Errorf("compile lets_encrypt domain pattern: %q, %v", pattern, err)
+		}
+	}
+	cfg.buildHostPolicy()
 
-	Cfg.setupDefaultOptions()
-	Cfg.buildHostPolicy()
+	cfg.Storage.Backend, err = buildStorage(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("setup storage backend: %v", err)
+	}
+	cfg.Storage.Locker = cfg.Storage.Backend
 
-	switch Cfg.Storage.Type {
+	// Cache keeps the autocert.Cache view available for the dir_cache
+	// and redis backends, which both still back an autocert.Manager
+	// directly; s3 and etcd are only exposed through Backend.
+	switch cfg.Storage.Type {
 	case "dir_cache":
-		Cfg.Storage.Cache, _ = NewDirCache(Cfg.Storage.DirCache)
+		cfg.Storage.Cache, _ = NewDirCache(cfg.Storage.DirCache)
 	case "redis":
-		Cfg.Storage.Cache, err = NewRedisCache(Cfg.Storage.Redis.Addr)
+		cfg.Storage.Cache, err = NewRedisCache(cfg.Storage.Redis.Addr)
 		if err != nil {
-			log.Fatalf("[FATAL] server: failed setup redis storage: %v", err)
+			return nil, fmt.Errorf("setup redis storage: %v", err)
 		}
 	}
 
-	for i := range Cfg.Managed {
-		pattern := Cfg.Managed[i].Pattern
+	if len(cfg.LetsEncrypt.Wildcards) > 0 {
+		provider, err := buildDNSProvider(cfg.DNSChallenge)
+		if err != nil {
+			return nil, fmt.Errorf("setup dns_challenge: %v", err)
+		}
+		cfg.DNSSolver = newDNSSolver(provider, cfg.DNSChallenge)
+	}
+
+	if len(cfg.Issuers) == 0 {
+		// Backward-compat default: no `issuers:` configured, so keep
+		// behaving like every deployment that predates it, issuing
+		// through the legacy autocert.Manager path rather than
+		// requiring dns_challenge. Wildcards still need a dns-01
+		// issuer, appended as a fallback the chain reaches if the
+		// autocert issuer rejects the (wildcard) name.
+		chain := IssuerChain{newAutocertIssuer("autocert", cfg)}
+		if cfg.DNSSolver != nil {
+			chain = append(chain, newACMEIssuer("lets_encrypt#dns01", IssuerConfig{
+				Type:     "lets_encrypt",
+				Staging:  cfg.LetsEncrypt.Staging,
+				Email:    cfg.LetsEncrypt.Email,
+				ForceRSA: cfg.LetsEncrypt.ForceRSA,
+			}, cfg.DNSSolver))
+		}
+		cfg.IssuerChain = chain
+	} else {
+		cfg.IssuerChain, err = buildIssuerChain(cfg.Issuers, cfg.DNSSolver)
+		if err != nil {
+			return nil, fmt.Errorf("build issuer chain: %v", err)
+		}
+	}
+
+	for i := range cfg.Managed {
+		pattern := cfg.Managed[i].Pattern
 		re, err := regexp.Compile(pattern)
 		if err != nil {
-			log.Fatalf("[FATAL] server: failed compile managed domain pattern: %q, %v", pattern, err)
+			return nil, fmt.Errorf("compile managed domain pattern: %q, %v", pattern, err)
 		}
-		Cfg.Managed[i].Regex = re
+		cfg.Managed[i].Regex = re
 	}
+	return cfg, nil
+}
+
+func initConfig() {
+	cfg, err := loadConfigFile(Flags.ConfigFile)
+	if err != nil {
+		log.Fatalf("[FATAL] server: failed read configuration: %v", err)
+	}
+	server.SetRenewalWindowRatio(cfg.LetsEncrypt.RenewalWindowRatio)
+	Reloader = NewConfigReloader(Flags.ConfigFile, cfg)
+}
+
+// CurrentConfig returns the currently active configuration. Safe for
+// concurrent use with a SIGHUP/`/debug/reload`-triggered Reload; callers
+// must not hold onto the returned *config across a reload if they need to
+// observe subsequent changes, and should call CurrentConfig again instead.
+func CurrentConfig() *config {
+	return Reloader.Current()
 }
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/acme"
+)
+
+// zoneCut describes the authoritative zone enclosing a domain name, as
+// discovered by findZoneCut.
+type zoneCut struct {
+	zone        string
+	nameservers []string // host:port, each a nameserver for zone
+}
+
+// findZoneCut walks from domain's full name up through its parent labels,
+// querying NS records at each step, and returns the first level at which
+// some are found - i.e. the enclosing zone's apex. A fixed label count
+// (e.g. "last two labels") is wrong for any domain under a multi-label
+// public suffix (e.g. "foo.example.co.uk" has zone "example.co.uk", not
+// "co.uk"); walking until NS answers finds the real cut regardless of how
+// many labels the public suffix has.
+func findZoneCut(ctx context.Context, domain string) (zoneCut, error) {
+	labels := splitDomainLabels(domain)
+	for i := range labels {
+		if i == len(labels)-1 {
+			// Last label alone is the bare TLD; not a zone we can update
+			// or usefully poll.
+			break
+		}
+		zone := joinDomainLabels(labels[i:])
+		nss, err := net.DefaultResolver.LookupNS(ctx, zone)
+		if err != nil || len(nss) == 0 {
+			continue
+		}
+		addrs := make([]string, 0, len(nss))
+		for _, ns := range nss {
+			addrs = append(addrs, strings.TrimSuffix(ns.Host, ".")+":53")
+		}
+		return zoneCut{zone: zone, nameservers: addrs}, nil
+	}
+	return zoneCut{}, fmt.Errorf("no authoritative nameservers found for %q", domain)
+}
+
+// dns01TXTValue computes the value published in the "_acme-challenge" TXT
+// record, per RFC 8555 §8.4: base64url(SHA256(keyAuthorization)).
+func dns01TXTValue(keyAuth string) string {
+	h := sha256.Sum256([]byte(keyAuth))
+	return base64.RawURLEncoding.EncodeToString(h[:])
+}
+
+// splitDomainLabels splits "www.example.com" into ["www", "example", "com"].
+func splitDomainLabels(domain string) []string {
+	return strings.Split(strings.Trim(domain, "."), ".")
+}
+
+func joinDomainLabels(labels []string) string {
+	return strings.Join(labels, ".")
+}
+
+func splitHostPort(addr string) (host, port string, err error) {
+	return net.SplitHostPort(addr)
+}
+
+// dnsSolver drives the dns-01 challenge flow: present the TXT record, wait
+// for it to propagate to authoritative nameservers, tell the ACME server
+// to validate, then clean up.
+type dnsSolver struct {
+	provider  DNSProvider
+	resolvers []string
+	timeout   time.Duration
+}
+
+func newDNSSolver(provider DNSProvider, cfg DNSChallengeConfig) *dnsSolver {
+	timeout := time.Duration(cfg.PropagationTimeout) * time.Second
+	if timeout <= 0 {
+		timeout = 120 * time.Second
+	}
+	return &dnsSolver{provider: provider, resolvers: cfg.Resolvers, timeout: timeout}
+}
+
+// Solve presents the DNS record for domain, waits for it to be visible on
+// the configured (or authoritative) nameservers, and returns once it is
+// safe to ask the ACME server to validate the challenge. The caller is
+// responsible for calling CleanUp once the order has been finalized.
+func (p *dnsSolver) Solve(ctx context.Context, domain string, chal *acme.Challenge, keyAuth string) error {
+	if err := p.provider.Present(ctx, domain, chal.Token, keyAuth); err != nil {
+		return fmt.Errorf("dns01: present record for %q: %v", domain, err)
+	}
+	if err := p.waitPropagation(ctx, domain, dns01TXTValue(keyAuth)); err != nil {
+		_ = p.provider.CleanUp(ctx, domain, chal.Token, keyAuth)
+		return fmt.Errorf("dns01: %v", err)
+	}
+	return nil
+}
+
+func (p *dnsSolver) CleanUp(ctx context.Context, domain string, chal *acme.Challenge, keyAuth string) error {
+	return p.provider.CleanUp(ctx, domain, chal.Token, keyAuth)
+}
+
+// waitPropagation polls resolvers (falling back to the authoritative NS
+// records for the zone when none are configured) until the expected TXT
+// value is visible everywhere, or p.timeout elapses.
+func (p *dnsSolver) waitPropagation(ctx context.Context, domain, expected string) error {
+	name := "_acme-challenge." + domain
+	resolvers := p.resolvers
+	if len(resolvers) == 0 {
+		var err error
+		resolvers, err = authoritativeNameservers(ctx, domain)
+		if err != nil {
+			return fmt.Errorf("resolve authoritative nameservers for %q: %v", domain, err)
+		}
+	}
+
+	deadline := time.Now().Add(p.timeout)
+	pollCtx, cancel := context.WithDeadline(ctx, deadline)
+	defer cancel()
+	for {
+		if allResolversHaveRecord(pollCtx, name, expected, resolvers) {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out waiting for %q to propagate to %v", name, resolvers)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(5 * time.Second):
+		}
+	}
+}
+
+func authoritativeNameservers(ctx context.Context, domain string) ([]string, error) {
+	cut, err := findZoneCut(ctx, domain)
+	if err != nil {
+		return nil, err
+	}
+	return cut.nameservers, nil
+}
+
+// allResolversHaveRecord reports whether every resolver in resolvers
+// currently answers name with a TXT record equal to expected. The query
+// itself (not just connection setup) is bound by ctx, so a resolver that
+// accepts the connection but never answers can't stall waitPropagation past
+// its configured PropagationTimeout.
+func allResolversHaveRecord(ctx context.Context, name, expected string, resolvers []string) bool {
+	for _, addr := range resolvers {
+		r := &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				d := net.Dialer{Timeout: 5 * time.Second}
+				return d.DialContext(ctx, network, addr)
+			},
+		}
+		txts, err := r.LookupTXT(ctx, name)
+		if err != nil {
+			return false
+		}
+		found := false
+		for _, t := range txts {
+			if t == expected {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
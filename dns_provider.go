@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"fmt"
+)
+
+// DNSProvider creates and removes the TXT record used to satisfy an ACME
+// dns-01 challenge. Implementations are responsible for talking to a
+// specific DNS host/provider API; CleanUp must be safe to call even if
+// Present partially failed.
+type DNSProvider interface {
+	// Present creates the TXT record "_acme-challenge.<domain>" with the
+	// value derived from token/keyAuth.
+	Present(ctx context.Context, domain, token, keyAuth string) error
+
+	// CleanUp removes the TXT record created by Present.
+	CleanUp(ctx context.Context, domain, token, keyAuth string) error
+}
+
+// DNSChallengeConfig configures the dns_challenge section of conf.yaml,
+// selecting and configuring a single DNSProvider.
+type DNSChallengeConfig struct {
+	Provider string `yaml:"provider"` // cloudflare | route53 | digitalocean | rfc2136
+
+	Cloudflare struct {
+		APIToken string `yaml:"api_token"`
+	} `yaml:"cloudflare"`
+
+	Route53 struct {
+		Region          string `yaml:"region"`
+		AccessKeyID     string `yaml:"access_key_id"`
+		SecretAccessKey string `yaml:"secret_access_key"`
+		HostedZoneID    string `yaml:"hosted_zone_id"`
+	} `yaml:"route53"`
+
+	DigitalOcean struct {
+		APIToken string `yaml:"api_token"`
+	} `yaml:"digitalocean"`
+
+	RFC2136 struct {
+		Nameserver    string `yaml:"nameserver"` // host:port, default port 53
+		TSIGKey       string `yaml:"tsig_key"`
+		TSIGSecret    string `yaml:"tsig_secret"`
+		TSIGAlgorithm string `yaml:"tsig_algorithm"` // default: hmac-sha256
+	} `yaml:"rfc2136"`
+
+	// PropagationTimeout bounds how long we poll authoritative
+	// nameservers for the TXT record before giving up. Default: 120s.
+	PropagationTimeout int `yaml:"propagation_timeout"`
+
+	// Resolvers, when set, are polled directly (as host:port) for the
+	// challenge TXT record. Default: the zone's authoritative
+	// nameservers, found through an NS lookup on the system resolver.
+	Resolvers []string `yaml:"resolvers"`
+}
+
+// buildDNSProvider constructs the DNSProvider selected by cfg.Provider.
+func buildDNSProvider(cfg DNSChallengeConfig) (DNSProvider, error) {
+	switch cfg.Provider {
+	case "cloudflare":
+		return newCloudflareProvider(cfg.Cloudflare.APIToken), nil
+	case "route53":
+		r := cfg.Route53
+		return newRoute53Provider(r.Region, r.AccessKeyID, r.SecretAccessKey, r.HostedZoneID), nil
+	case "digitalocean":
+		return newDigitalOceanProvider(cfg.DigitalOcean.APIToken), nil
+	case "rfc2136":
+		r := cfg.RFC2136
+		algo := r.TSIGAlgorithm
+		if algo == "" {
+			algo = "hmac-sha256"
+		}
+		return newRFC2136Provider(r.Nameserver, r.TSIGKey, r.TSIGSecret, algo), nil
+	default:
+		return nil, fmt.Errorf("dns_challenge: unknown provider %q", cfg.Provider)
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+const cloudflareAPIBase = "https://api.cloudflare.com/client/v4"
+
+// cloudflareProvider implements DNSProvider against the Cloudflare DNS API.
+type cloudflareProvider struct {
+	apiToken string
+	client   *http.Client
+}
+
+func newCloudflareProvider(apiToken string) *cloudflareProvider {
+	return &cloudflareProvider{apiToken: apiToken, client: http.DefaultClient}
+}
+
+type cloudflareRecord struct {
+	ID      string `json:"id,omitempty"`
+	Type    string `json:"type"`
+	Name    string `json:"name"`
+	Content string `json:"content"`
+	TTL     int    `json:"ttl"`
+}
+
+func (p *cloudflareProvider) Present(ctx context.Context, domain, token, keyAuth string) error {
+	zoneID, err := p.zoneIDForDomain(ctx, domain)
+	if err != nil {
+		return fmt.Errorf("cloudflare: %v", err)
+	}
+	rec := cloudflareRecord{
+		Type:    "TXT",
+		Name:    "_acme-challenge." + domain,
+		Content: dns01TXTValue(keyAuth),
+		TTL:     120,
+	}
+	body, _ := json.Marshal(rec)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+		fmt.Sprintf("%s/zones/%s/dns_records", cloudflareAPIBase, zoneID), bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("cloudflare: %v", err)
+	}
+	p.authorize(req)
+	return p.doAndCheck(req)
+}
+
+func (p *cloudflareProvider) CleanUp(ctx context.Context, domain, token, keyAuth string) error {
+	zoneID, err := p.zoneIDForDomain(ctx, domain)
+	if err != nil {
+		return fmt.Errorf("cloudflare: %v", err)
+	}
+	recordID, err := p.findRecordID(ctx, zoneID, domain, dns01TXTValue(keyAuth))
+	if err != nil {
+		return fmt.Errorf("cloudflare: %v", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete,
+		fmt.Sprintf("%s/zones/%s/dns_records/%s", cloudflareAPIBase, zoneID, recordID), nil)
+	if err != nil {
+		return fmt.Errorf("cloudflare: %v", err)
+	}
+	p.authorize(req)
+	return p.doAndCheck(req)
+}
+
+func (p *cloudflareProvider) authorize(req *http.Request) {
+	req.Header.Set("Authorization", "Bearer "+p.apiToken)
+	req.Header.Set("Content-Type", "application/json")
+}
+
+func (p *cloudflareProvider) doAndCheck(req *http.Request) error {
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+type cloudflareZoneList struct {
+	Result []struct {
+		ID string `json:"id"`
+	} `json:"result"`
+}
+
+// zoneIDForDomain walks domain and then its parent labels (e.g. for
+// "www.example.com" tries "www.example.com", then "example.com", ...)
+// until the Cloudflare zones endpoint reports a match.
+func (p *cloudflareProvider) zoneIDForDomain(ctx context.Context, domain string) (string, error) {
+	labels := splitDomainLabels(domain)
+	for i := range labels {
+		candidate := joinDomainLabels(labels[i:])
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+			fmt.Sprintf("%s/zones?name=%s", cloudflareAPIBase, candidate), nil)
+		if err != nil {
+			return "", err
+		}
+		p.authorize(req)
+		resp, err := p.client.Do(req)
+		if err != nil {
+			return "", err
+		}
+		var zones cloudflareZoneList
+		err = json.NewDecoder(resp.Body).Decode(&zones)
+		resp.Body.Close()
+		if err != nil {
+			return "", err
+		}
+		if len(zones.Result) > 0 {
+			return zones.Result[0].ID, nil
+		}
+	}
+	return "", fmt.Errorf("no zone found for domain %q", domain)
+}
+
+type cloudflareRecordList struct {
+	Result []cloudflareRecord `json:"result"`
+}
+
+// findRecordID looks up the TXT record previously created by Present so
+// CleanUp can delete it by ID.
+func (p *cloudflareProvider) findRecordID(ctx context.Context, zoneID, domain, value string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		fmt.Sprintf("%s/zones/%s/dns_records?type=TXT&name=%s&content=%s",
+			cloudflareAPIBase, zoneID, "_acme-challenge."+domain, value), nil)
+	if err != nil {
+		return "", err
+	}
+	p.authorize(req)
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	var records cloudflareRecordList
+	if err := json.NewDecoder(resp.Body).Decode(&records); err != nil {
+		return "", err
+	}
+	if len(records.Result) == 0 {
+		return "", fmt.Errorf("record not found for domain %q", domain)
+	}
+	return records.Result[0].ID, nil
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const digitalOceanAPIBase = "https://api.digitalocean.com/v2"
+
+// digitalOceanProvider implements DNSProvider against the DigitalOcean
+// Domains API.
+type digitalOceanProvider struct {
+	apiToken string
+	client   *http.Client
+}
+
+func newDigitalOceanProvider(apiToken string) *digitalOceanProvider {
+	return &digitalOceanProvider{apiToken: apiToken, client: http.DefaultClient}
+}
+
+type doRecordRequest struct {
+	Type string `json:"type"`
+	Name string `json:"name"`
+	Data string `json:"data"`
+	TTL  int    `json:"ttl"`
+}
+
+type doRecordResponse struct {
+	DomainRecord struct {
+		ID int64 `json:"id"`
+	} `json:"domain_record"`
+}
+
+type doRecordList struct {
+	DomainRecords []struct {
+		ID   int64  `json:"id"`
+		Name string `json:"name"`
+		Data string `json:"data"`
+	} `json:"domain_records"`
+}
+
+func (p *digitalOceanProvider) Present(ctx context.Context, domain, token, keyAuth string) error {
+	zone, sub := splitDigitalOceanZone(domain)
+	rec := doRecordRequest{Type: "TXT", Name: sub, Data: dns01TXTValue(keyAuth), TTL: 120}
+	body, _ := json.Marshal(rec)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+		fmt.Sprintf("%s/domains/%s/records", digitalOceanAPIBase, zone), bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("digitalocean: %v", err)
+	}
+	p.authorize(req)
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("digitalocean: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("digitalocean: unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+func (p *digitalOceanProvider) CleanUp(ctx context.Context, domain, token, keyAuth string) error {
+	zone, sub := splitDigitalOceanZone(domain)
+	recID, err := p.findRecordID(ctx, zone, sub, dns01TXTValue(keyAuth))
+	if err != nil {
+		return fmt.Errorf("digitalocean: %v", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete,
+		fmt.Sprintf("%s/domains/%s/records/%d", digitalOceanAPIBase, zone, recID), nil)
+	if err != nil {
+		return fmt.Errorf("digitalocean: %v", err)
+	}
+	p.authorize(req)
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("digitalocean: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("digitalocean: unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+func (p *digitalOceanProvider) findRecordID(ctx context.Context, zone, sub, value string) (int64, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		fmt.Sprintf("%s/domains/%s/records?type=TXT&name=%s.%s", digitalOceanAPIBase, zone, sub, zone), nil)
+	if err != nil {
+		return 0, err
+	}
+	p.authorize(req)
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	var list doRecordList
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return 0, err
+	}
+	for _, r := range list.DomainRecords {
+		if r.Data == value {
+			return r.ID, nil
+		}
+	}
+	return 0, fmt.Errorf("record not found")
+}
+
+func (p *digitalOceanProvider) authorize(req *http.Request) {
+	req.Header.Set("Authorization", "Bearer "+p.apiToken)
+	req.Header.Set("Content-Type", "application/json")
+}
+
+// splitDigitalOceanZone splits the challenge name for domain (for
+// "www.example.com", "_acme-challenge.www.example.com") into the zone,
+// taken as its last two labels ("example.com"), and the record name
+// relative to it ("_acme-challenge.www"). DigitalOcean's API takes record names relative
+// to the zone apex rather than fully-qualified.
+func splitDigitalOceanZone(domain string) (zone, sub string) {
+	labels := splitDomainLabels("_acme-challenge." + domain)
+	if len(labels) < 2 {
+		return domain, "_acme-challenge"
+	}
+	zone = strings.Join(labels[len(labels)-2:], ".")
+	sub = strings.Join(labels[:len(labels)-2], ".")
+	return zone, sub
+}
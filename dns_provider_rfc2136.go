@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// rfc2136Provider implements DNSProvider via RFC 2136 dynamic DNS updates,
+// for on-prem/private nameservers (BIND, Knot, PowerDNS, ...).
+type rfc2136Provider struct {
+	nameserver string
+	tsigKey    string
+	tsigSecret string
+	algorithm  string
+}
+
+func newRFC2136Provider(nameserver, tsigKey, tsigSecret, algorithm string) *rfc2136Provider {
+	if _, _, err := splitHostPort(nameserver); err != nil {
+		nameserver = nameserver + ":53"
+	}
+	return &rfc2136Provider{
+		nameserver: nameserver,
+		tsigKey:    tsigKey,
+		tsigSecret: tsigSecret,
+		algorithm:  algorithm,
+	}
+}
+
+func (p *rfc2136Provider) Present(ctx context.Context, domain, token, keyAuth string) error {
+	return p.update(ctx, domain, keyAuth, false)
+}
+
+func (p *rfc2136Provider) CleanUp(ctx context.Context, domain, token, keyAuth string) error {
+	return p.update(ctx, domain, keyAuth, true)
+}
+
+func (p *rfc2136Provider) update(ctx context.Context, domain, keyAuth string, remove bool) error {
+	cut, err := findZoneCut(ctx, domain)
+	if err != nil {
+		return fmt.Errorf("rfc2136: find zone for %q: %v", domain, err)
+	}
+	zone := dns.Fqdn(cut.zone)
+	name := dns.Fqdn("_acme-challenge." + domain)
+
+	m := new(dns.Msg)
+	m.SetUpdate(zone)
+	rr, err := dns.NewRR(fmt.Sprintf("%s 120 IN TXT %q", name, dns01TXTValue(keyAuth)))
+	if err != nil {
+		return fmt.Errorf("rfc2136: %v", err)
+	}
+	if remove {
+		m.Remove([]dns.RR{rr})
+	} else {
+		m.Insert([]dns.RR{rr})
+	}
+
+	client := new(dns.Client)
+	if p.tsigKey != "" {
+		keyName := dns.Fqdn(p.tsigKey)
+		m.SetTsig(keyName, p.algorithm, 300, time.Now().Unix())
+		client.TsigSecret = map[string]string{keyName: p.tsigSecret}
+	}
+
+	_, _, err = client.Exchange(m, p.nameserver)
+	if err != nil {
+		return fmt.Errorf("rfc2136: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/route53"
+	"github.com/aws/aws-sdk-go-v2/service/route53/types"
+)
+
+// route53Provider implements DNSProvider against AWS Route53.
+type route53Provider struct {
+	hostedZoneID string
+	client       *route53.Client
+}
+
+func newRoute53Provider(region, accessKeyID, secretAccessKey, hostedZoneID string) *route53Provider {
+	client := route53.New(route53.Options{
+		Region:      region,
+		Credentials: credentials.NewStaticCredentialsProvider(accessKeyID, secretAccessKey, ""),
+	})
+	return &route53Provider{hostedZoneID: hostedZoneID, client: client}
+}
+
+func (p *route53Provider) Present(ctx context.Context, domain, token, keyAuth string) error {
+	return p.changeRecord(ctx, domain, keyAuth, types.ChangeActionUpsert)
+}
+
+func (p *route53Provider) CleanUp(ctx context.Context, domain, token, keyAuth string) error {
+	return p.changeRecord(ctx, domain, keyAuth, types.ChangeActionDelete)
+}
+
+func (p *route53Provider) changeRecord(ctx context.Context, domain, keyAuth string, action types.ChangeAction) error {
+	name := "_acme-challenge." + domain
+	value := fmt.Sprintf("%q", dns01TXTValue(keyAuth))
+	_, err := p.client.ChangeResourceRecordSets(ctx, &route53.ChangeResourceRecordSetsInput{
+		HostedZoneId: aws.String(p.hostedZoneID),
+		ChangeBatch: &types.ChangeBatch{
+			Changes: []types.Change{{
+				Action: action,
+				ResourceRecordSet: &types.ResourceRecordSet{
+					Name:            aws.String(name),
+					Type:            types.RRTypeTxt,
+					TTL:             aws.Int64(60),
+					ResourceRecords: []types.ResourceRecord{{Value: aws.String(value)}},
+				},
+			}},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("route53: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,367 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"fmt"
+	"log"
+
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// stagingDirectoryURL is the Let's Encrypt staging ACME directory, used
+// when an issuer's Staging option is set.
+const stagingDirectoryURL = "https://acme-staging-v02.api.letsencrypt.org/directory"
+
+// Issuer obtains and revokes certificates from a single certificate
+// authority. The server tries configured issuers in order, falling through
+// to the next one when an issuer fails with a non-fatal error (rate-limit,
+// network, CA-side policy rejection), so a single flaky or exhausted CA
+// does not take the whole server down.
+type Issuer interface {
+	// Name identifies the issuer in logs.
+	Name() string
+
+	// Issue requests a certificate for domains, signed with key. Each
+	// Issuer builds its own CSR from key and domains, since whether to
+	// assert must-staple on it is a per-issuer setting.
+	Issue(ctx context.Context, key crypto.Signer, domains []string) (*tls.Certificate, error)
+
+	// Revoke revokes a previously issued certificate.
+	Revoke(ctx context.Context, cert *x509.Certificate) error
+}
+
+// IssuerChain tries each Issuer in order and returns the first certificate
+// successfully obtained. An issuer is considered to have failed hard (and
+// the chain moves on to the next one) when Issue returns a non-nil error;
+// transient vs. permanent classification is left to the issuer itself.
+type IssuerChain []Issuer
+
+// IssueWithLock is like Issue, but first acquires locker's lock for key so
+// that when multiple ssl-cert-server instances share the same storage
+// backend, only one of them performs the ACME order for a given domain at
+// a time; the others block on the lock and then run the chain themselves.
+// Storage is not checked for a certificate written by the lock's previous
+// holder.
+func (p IssuerChain) IssueWithLock(ctx context.Context, locker Locker, key string, signer crypto.Signer, domains []string) (*tls.Certificate, error) {
+	var tlscert *tls.Certificate
+	err := withLock(ctx, locker, key, func() error {
+		var err error
+		tlscert, err = p.Issue(ctx, signer, domains)
+		return err
+	})
+	return tlscert, err
+}
+
+func (p IssuerChain) Issue(ctx context.Context, signer crypto.Signer, domains []string) (*tls.Certificate, error) {
+	var lastErr error
+	for _, iss := range p {
+		tlscert, err := iss.Issue(ctx, signer, domains)
+		if err == nil {
+			return tlscert, nil
+		}
+		log.Printf("[WARN] server: issuer %q failed, trying next: %v", iss.Name(), err)
+		lastErr = err
+	}
+	if lastErr == nil {
+		return nil, fmt.Errorf("issuer: no issuers configured")
+	}
+	return nil, fmt.Errorf("issuer: all issuers failed, last error: %v", lastErr)
+}
+
+// EABConfig holds the External Account Binding credentials required by
+// ZeroSSL and most private ACME CAs to associate an ACME account with an
+// existing account on the CA side.
+type EABConfig struct {
+	KID     string `yaml:"kid"`
+	HMACKey string `yaml:"hmac_key"`
+}
+
+// IssuerConfig configures a single entry of the `issuers` chain in
+// conf.yaml, e.g.:
+//
+//	issuers:
+//	  - type: lets_encrypt
+//	    email: admin@example.com
+//	  - type: zerossl
+//	    email: admin@example.com
+//	    eab:
+//	      kid: "..."
+//	      hmac_key: "..."
+type IssuerConfig struct {
+	Type         string     `yaml:"type"` // lets_encrypt | zerossl | acme
+	Staging      bool       `yaml:"staging"`       // default: false
+	DirectoryURL string     `yaml:"directory_url"` // required when type is "acme"
+	Email        string     `yaml:"email"`
+	ForceRSA     bool       `yaml:"force_rsa"` // default: false
+	EAB          *EABConfig `yaml:"eab"`
+
+	// MustStaple, when true, asks this issuer to request certificates
+	// with the TLS Feature extension (RFC 7633) asserting OCSP
+	// must-staple. The extension has to be present on the CSR itself,
+	// so callers building a CSR for this issuer should add
+	// mustStapleExtension() to its ExtraExtensions when MustStaple is
+	// set.
+	MustStaple bool `yaml:"must_staple"`
+}
+
+// tlsFeatureExtensionOID is the TLS Feature extension from RFC 7633,
+// id-pe-tlsfeature (1.3.6.1.5.5.7.1.24).
+var tlsFeatureExtensionOID = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 24}
+
+// mustStapleExtension returns the CSR extension requesting OCSP
+// must-staple: DER(SEQUENCE{INTEGER 5}), where 5 is the TLS feature ID for
+// status_request (OCSP stapling), per RFC 7633 §6.
+func mustStapleExtension() pkix.Extension {
+	der, err := asn1.Marshal([]int{5})
+	if err != nil {
+		// asn1.Marshal only fails on unsupported Go types; []int is
+		// always supported, so this is unreachable.
+		panic(err)
+	}
+	return pkix.Extension{Id: tlsFeatureExtensionOID, Value: der}
+}
+
+// generateCSR builds a PKCS#10 certificate signing request for domains,
+// signed by key, for a single issuer's Issue call. It adds the must-staple
+// extension only when that issuer (cfg) is configured to request it, since
+// the extension is asserted on the CSR itself and different issuers in the
+// same chain may disagree on whether a CA accepts it.
+func generateCSR(key crypto.Signer, domains []string, cfg IssuerConfig) ([]byte, error) {
+	tmpl := &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: domains[0]},
+		DNSNames: domains,
+	}
+	if cfg.MustStaple {
+		tmpl.ExtraExtensions = append(tmpl.ExtraExtensions, mustStapleExtension())
+	}
+	return x509.CreateCertificateRequest(rand.Reader, tmpl, key)
+}
+
+const zeroSSLDirectoryURL = "https://acme.zerossl.com/v2/DV90"
+
+// acmeIssuer issues certificates through a generic ACME client, optionally
+// registering the account with External Account Binding as required by
+// ZeroSSL and some private ACME CAs.
+type acmeIssuer struct {
+	name   string
+	cfg    IssuerConfig
+	client *acme.Client
+
+	// dnsSolver, when non-nil, is used to satisfy dns-01 challenges. This
+	// issuer has no http-01 responder of its own (that path is still
+	// served by the legacy autocert.Manager), so authorizations that
+	// offer no dns-01 challenge, or for which dnsSolver is nil, fail.
+	dnsSolver *dnsSolver
+}
+
+// newACMEIssuer builds an Issuer backed by an ACME directory. The
+// directory URL is resolved from well-known issuer types (lets_encrypt,
+// zerossl) or taken verbatim from cfg.DirectoryURL for type "acme".
+// dnsSolver, if non-nil, is used to satisfy dns-01 challenges (required
+// for wildcard names, and the only challenge type this issuer supports).
+func newACMEIssuer(name string, cfg IssuerConfig, dnsSolver *dnsSolver) *acmeIssuer {
+	dirURL := cfg.DirectoryURL
+	switch cfg.Type {
+	case "lets_encrypt":
+		if cfg.Staging {
+			dirURL = stagingDirectoryURL
+		} else {
+			dirURL = acme.LetsEncryptURL
+		}
+	case "zerossl":
+		dirURL = zeroSSLDirectoryURL
+	}
+	return &acmeIssuer{
+		name: name,
+		cfg:  cfg,
+		client: &acme.Client{
+			DirectoryURL: dirURL,
+		},
+		dnsSolver: dnsSolver,
+	}
+}
+
+func (p *acmeIssuer) Name() string { return p.name }
+
+// register creates or reuses the ACME account backing this issuer. When
+// cfg.EAB is set, the account key is bound to the CA's existing account
+// via External Account Binding before any order is placed, as required by
+// ZeroSSL and most private ACME CAs.
+func (p *acmeIssuer) register(ctx context.Context) (*acme.Account, error) {
+	acct := &acme.Account{Contact: []string{"mailto:" + p.cfg.Email}}
+	if p.cfg.EAB != nil {
+		// CAs hand out the EAB HMAC key as base64url text; it has to be
+		// decoded to the raw MAC key bytes before use, or every EAB
+		// registration signs with the wrong key and is rejected.
+		key, err := base64.RawURLEncoding.DecodeString(p.cfg.EAB.HMACKey)
+		if err != nil {
+			return nil, fmt.Errorf("decode eab hmac_key: %v", err)
+		}
+		acct.ExternalAccountBinding = &acme.ExternalAccountBinding{
+			KID: p.cfg.EAB.KID,
+			Key: key,
+		}
+	}
+	return p.client.Register(ctx, acct, acme.AcceptTOS)
+}
+
+// Issue runs the full RFC 8555 order flow: build a CSR for domains
+// (asserting must-staple when p.cfg requests it), authorize an order,
+// satisfy each of its pending authorizations, wait for the order to
+// become ready, and finalize it.
+func (p *acmeIssuer) Issue(ctx context.Context, key crypto.Signer, domains []string) (*tls.Certificate, error) {
+	if _, err := p.register(ctx); err != nil {
+		return nil, err
+	}
+	csr, err := generateCSR(key, domains, p.cfg)
+	if err != nil {
+		return nil, fmt.Errorf("issuer %s: generate csr: %v", p.name, err)
+	}
+	order, err := p.client.AuthorizeOrder(ctx, acme.DomainIDs(domains...))
+	if err != nil {
+		return nil, fmt.Errorf("issuer %s: authorize order: %v", p.name, err)
+	}
+	for _, authzURL := range order.AuthzURLs {
+		if err := p.solveAuthorization(ctx, authzURL); err != nil {
+			return nil, fmt.Errorf("issuer %s: %v", p.name, err)
+		}
+	}
+	order, err = p.client.WaitOrder(ctx, order.URI)
+	if err != nil {
+		return nil, fmt.Errorf("issuer %s: wait order: %v", p.name, err)
+	}
+	der, _, err := p.client.CreateOrderCert(ctx, order.FinalizeURL, csr, true)
+	if err != nil {
+		return nil, fmt.Errorf("issuer %s: create order cert: %v", p.name, err)
+	}
+	return &tls.Certificate{Certificate: der}, nil
+}
+
+// solveAuthorization fetches the authorization at authzURL and satisfies
+// its dns-01 challenge, the only challenge type this issuer knows how to
+// answer (http-01 and tls-alpn-01 require a listener this generic ACME
+// client doesn't run; use the autocert issuer for those).
+func (p *acmeIssuer) solveAuthorization(ctx context.Context, authzURL string) error {
+	authz, err := p.client.GetAuthorization(ctx, authzURL)
+	if err != nil {
+		return fmt.Errorf("get authorization %q: %v", authzURL, err)
+	}
+	if authz.Status == acme.StatusValid {
+		return nil
+	}
+
+	var chal *acme.Challenge
+	for _, c := range authz.Challenges {
+		if c.Type == "dns-01" {
+			chal = c
+			break
+		}
+	}
+	if chal == nil {
+		return fmt.Errorf("no dns-01 challenge offered for %q", authz.Identifier.Value)
+	}
+	if p.dnsSolver == nil {
+		return fmt.Errorf("dns-01 challenge required for %q but no dns_challenge is configured", authz.Identifier.Value)
+	}
+
+	// The key authorization is the same value regardless of challenge
+	// type (RFC 8555 §8.1); HTTP01ChallengeResponse happens to return it
+	// unhashed, which is exactly what dnsSolver hashes into the TXT
+	// record value.
+	keyAuth, err := p.client.HTTP01ChallengeResponse(chal.Token)
+	if err != nil {
+		return fmt.Errorf("build key authorization: %v", err)
+	}
+	if err := p.dnsSolver.Solve(ctx, authz.Identifier.Value, chal, keyAuth); err != nil {
+		return err
+	}
+	defer p.dnsSolver.CleanUp(ctx, authz.Identifier.Value, chal, keyAuth)
+
+	if _, err := p.client.Accept(ctx, chal); err != nil {
+		return fmt.Errorf("accept dns-01 challenge: %v", err)
+	}
+	if _, err := p.client.WaitAuthorization(ctx, authzURL); err != nil {
+		return fmt.Errorf("wait authorization: %v", err)
+	}
+	return nil
+}
+
+func (p *acmeIssuer) Revoke(ctx context.Context, cert *x509.Certificate) error {
+	if err := p.client.RevokeCert(ctx, nil, cert.Raw, acme.CRLReasonUnspecified); err != nil {
+		return fmt.Errorf("issuer %s: revoke cert: %v", p.name, err)
+	}
+	return nil
+}
+
+// autocertIssuer adapts the legacy golang.org/x/crypto/acme/autocert.Manager
+// path to the Issuer interface, so the backward-compatible default chain
+// (no `issuers:` configured) keeps working through Manager's own http-01/
+// tls-alpn-01 flow rather than requiring dns_challenge to be set up, as
+// every deployment predating the `issuers:` list relies on.
+type autocertIssuer struct {
+	name    string
+	manager *autocert.Manager
+}
+
+// newAutocertIssuer builds an Issuer backed by an autocert.Manager sharing
+// cfg's cache, host policy and Let's Encrypt account settings.
+func newAutocertIssuer(name string, cfg *config) *autocertIssuer {
+	return &autocertIssuer{
+		name: name,
+		manager: &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			Cache:      cfg.Storage.Cache,
+			HostPolicy: cfg.LetsEncrypt.HostPolicy,
+			Email:      cfg.LetsEncrypt.Email,
+			Client:     &acme.Client{DirectoryURL: cfg.LetsEncrypt.DirectoryURL},
+		},
+	}
+}
+
+func (p *autocertIssuer) Name() string { return p.name }
+
+// Issue requests a certificate through autocert.Manager.GetCertificate,
+// which this snapshot's bare TLS listeners can drive directly via
+// tls-alpn-01 (there is no separate http-01 listener to wire up
+// Manager.HTTPHandler into). Manager issues one certificate per SNI host
+// name rather than per arbitrary CSR, so key is ignored (Manager generates
+// and manages its own per-host key) and exactly one DNS name is supported;
+// wildcard or multi-SAN names should go through one of the dns-01-capable
+// acmeIssuer entries instead.
+func (p *autocertIssuer) Issue(ctx context.Context, key crypto.Signer, domains []string) (*tls.Certificate, error) {
+	if len(domains) != 1 {
+		return nil, fmt.Errorf("issuer %s: autocert only supports a single domain per certificate, got %v", p.name, domains)
+	}
+	return p.manager.GetCertificate(&tls.ClientHelloInfo{ServerName: domains[0]})
+}
+
+func (p *autocertIssuer) Revoke(ctx context.Context, cert *x509.Certificate) error {
+	return fmt.Errorf("issuer %s: revocation is not supported through autocert.Manager", p.name)
+}
+
+// buildIssuerChain turns the configured `issuers` list into an IssuerChain,
+// tried in the order given in conf.yaml. dnsSolver, if non-nil, is handed
+// to every issuer so wildcard names (which only the dns-01 challenge can
+// authorize) can be issued through any of them. It returns an error rather
+// than exiting on an invalid entry, since it is also called from
+// ConfigReloader.Reload, where a bad SIGHUP-triggered config must be
+// rejected without taking down the running server.
+func buildIssuerChain(cfgs []IssuerConfig, dnsSolver *dnsSolver) (IssuerChain, error) {
+	chain := make(IssuerChain, 0, len(cfgs))
+	for i, cfg := range cfgs {
+		name := cfg.Type
+		if name == "" {
+			return nil, fmt.Errorf("issuers[%d]: missing type", i)
+		}
+		chain = append(chain, newACMEIssuer(fmt.Sprintf("%s#%d", name, i), cfg, dnsSolver))
+	}
+	return chain, nil
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"testing"
+)
+
+type stubIssuer struct {
+	name string
+	err  error
+	cert *tls.Certificate
+}
+
+func (s *stubIssuer) Name() string { return s.name }
+func (s *stubIssuer) Issue(ctx context.Context, key crypto.Signer, domains []string) (*tls.Certificate, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	return s.cert, nil
+}
+func (s *stubIssuer) Revoke(ctx context.Context, cert *x509.Certificate) error { return nil }
+
+func TestIssuerChainIssueFallsThrough(t *testing.T) {
+	want := &tls.Certificate{Certificate: [][]byte{{1, 2, 3}}}
+	chain := IssuerChain{
+		&stubIssuer{name: "first", err: errors.New("rate limited")},
+		&stubIssuer{name: "second", cert: want},
+	}
+	got, err := chain.Issue(context.Background(), nil, []string{"example.com"})
+	if err != nil {
+		t.Fatalf("Issue() error = %v, want nil", err)
+	}
+	if got != want {
+		t.Errorf("Issue() = %v, want the second issuer's certificate", got)
+	}
+}
+
+func TestIssuerChainIssueAllFail(t *testing.T) {
+	chain := IssuerChain{
+		&stubIssuer{name: "first", err: errors.New("boom 1")},
+		&stubIssuer{name: "second", err: errors.New("boom 2")},
+	}
+	_, err := chain.Issue(context.Background(), nil, []string{"example.com"})
+	if err == nil {
+		t.Fatal("Issue() error = nil, want an error naming the last issuer's failure")
+	}
+}
+
+func TestIssuerChainIssueEmpty(t *testing.T) {
+	var chain IssuerChain
+	_, err := chain.Issue(context.Background(), nil, []string{"example.com"})
+	if err == nil {
+		t.Fatal("Issue() error = nil, want an error for an empty chain")
+	}
+}
+
+func TestGenerateCSRAddsMustStapleWhenConfigured(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	csr, err := generateCSR(key, []string{"example.com"}, IssuerConfig{Type: "zerossl", MustStaple: true})
+	if err != nil {
+		t.Fatalf("generateCSR() error = %v", err)
+	}
+	parsed, err := x509.ParseCertificateRequest(csr)
+	if err != nil {
+		t.Fatalf("parse generated csr: %v", err)
+	}
+	found := false
+	for _, ext := range parsed.Extensions {
+		if ext.Id.Equal(tlsFeatureExtensionOID) {
+			found = true
+		}
+	}
+	if !found {
+		t.Error("generateCSR() did not attach the must-staple extension even though the issuer requested it")
+	}
+}
+
+func TestGenerateCSROmitsMustStapleByDefault(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	csr, err := generateCSR(key, []string{"example.com"}, IssuerConfig{Type: "lets_encrypt"})
+	if err != nil {
+		t.Fatalf("generateCSR() error = %v", err)
+	}
+	parsed, err := x509.ParseCertificateRequest(csr)
+	if err != nil {
+		t.Fatalf("parse generated csr: %v", err)
+	}
+	for _, ext := range parsed.Extensions {
+		if ext.Id.Equal(tlsFeatureExtensionOID) {
+			t.Error("generateCSR() attached the must-staple extension though the issuer didn't request it")
+		}
+	}
+}
+
+func TestGenerateCSRIsPerIssuer(t *testing.T) {
+	// Two issuers in the same chain with different MustStaple settings
+	// must not leak the extension onto each other's CSR.
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	plainCSR, err := generateCSR(key, []string{"example.com"}, IssuerConfig{Type: "lets_encrypt"})
+	if err != nil {
+		t.Fatalf("generateCSR() error = %v", err)
+	}
+	stapledCSR, err := generateCSR(key, []string{"example.com"}, IssuerConfig{Type: "zerossl", MustStaple: true})
+	if err != nil {
+		t.Fatalf("generateCSR() error = %v", err)
+	}
+	plainParsed, err := x509.ParseCertificateRequest(plainCSR)
+	if err != nil {
+		t.Fatalf("parse plain csr: %v", err)
+	}
+	if len(plainParsed.Extensions) != 0 {
+		t.Errorf("lets_encrypt issuer's csr picked up %d extensions from the zerossl issuer's must-staple request", len(plainParsed.Extensions))
+	}
+	stapledParsed, err := x509.ParseCertificateRequest(stapledCSR)
+	if err != nil {
+		t.Fatalf("parse stapled csr: %v", err)
+	}
+	found := false
+	for _, ext := range stapledParsed.Extensions {
+		if ext.Id.Equal(tlsFeatureExtensionOID) {
+			found = true
+		}
+	}
+	if !found {
+		t.Error("zerossl issuer's csr is missing the must-staple extension it requested")
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"reflect"
+	"regexp"
+	"sync/atomic"
+	"syscall"
+
+	"github.com/jxskiss/ssl-cert-server/server"
+)
+
+// ConfigReloader re-parses conf.yaml into a shadow *config, revalidates it
+// (compiling regexes, rebuilding the host policy, reconnecting storage
+// backends), and atomically swaps it in, so a SIGHUP (or a request to the
+// /debug/reload admin endpoint) picks up changes without dropping
+// in-flight requests against the previous configuration.
+type ConfigReloader struct {
+	path string
+	ptr  atomic.Pointer[config]
+}
+
+// NewConfigReloader wraps an already-loaded config for path, ready to
+// serve Reload() calls.
+func NewConfigReloader(path string, initial *config) *ConfigReloader {
+	r := &ConfigReloader{path: path}
+	r.ptr.Store(initial)
+	return r
+}
+
+// Current returns the currently active configuration. Safe for concurrent
+// use with Reload.
+func (r *ConfigReloader) Current() *config {
+	return r.ptr.Load()
+}
+
+// Reload re-reads and rebuilds the configuration from r.path and swaps it
+// in on success. The previous configuration keeps serving any requests
+// already in flight against it; only new lookups of Current observe the
+// new one. On parse/validation failure, the previous configuration is left
+// in place and an error is returned.
+func (r *ConfigReloader) Reload() error {
+	next, err := loadConfigFile(r.path)
+	if err != nil {
+		return fmt.Errorf("reload: %v", err)
+	}
+	prev := r.ptr.Swap(next)
+
+	server.SetRenewalWindowRatio(next.LetsEncrypt.RenewalWindowRatio)
+
+	log.Printf("[INFO] server: configuration reloaded: %s", diffConfig(prev, next))
+	notifyConfigReloaded(prev, next)
+	return nil
+}
+
+// WatchSIGHUP reloads the configuration every time the process receives
+// SIGHUP, logging (but not exiting on) reload errors.
+func (r *ConfigReloader) WatchSIGHUP() {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGHUP)
+	go func() {
+		for range sig {
+			if err := r.Reload(); err != nil {
+				log.Printf("[ERROR] server: config reload failed: %v", err)
+			}
+		}
+	}()
+}
+
+// ServeHTTP implements an alternative reload trigger, bound to the admin
+// listener as "/debug/reload", for environments where sending signals is
+// inconvenient (e.g. behind an orchestrator that doesn't expose PIDs).
+func (r *ConfigReloader) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.Reload(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintln(w, "reloaded")
+}
+
+// Reloader is the process-wide ConfigReloader set up by initConfig.
+var Reloader *ConfigReloader
+
+// WatchManagedCertEviction registers mgr to have its stale cache entries
+// evicted whenever a reload changes the managed-domain pattern list.
+func WatchManagedCertEviction(mgr *server.ManagedCertManager) {
+	OnConfigReload(func(prev, next *config) {
+		patterns := make([]*regexp.Regexp, len(next.Managed))
+		for i := range next.Managed {
+			patterns[i] = next.Managed[i].Regex
+		}
+		mgr.EvictRemoved(patterns)
+	})
+}
+
+// configReloadObservers are notified, in registration order, after a
+// successful reload. ManagedCertManager uses this to evict cache entries
+// whose managed Pattern was removed.
+var configReloadObservers []func(prev, next *config)
+
+// OnConfigReload registers fn to run after every successful reload.
+func OnConfigReload(fn func(prev, next *config)) {
+	configReloadObservers = append(configReloadObservers, fn)
+}
+
+func notifyConfigReloaded(prev, next *config) {
+	for _, fn := range configReloadObservers {
+		fn(prev, next)
+	}
+}
+
+// diffConfig produces a structured, best-effort summary of what changed
+// between two loaded configurations, for the reload log line. It compares
+// the top-level sections rather than doing a full recursive diff, which is
+// enough to tell an operator what to double check.
+func diffConfig(prev, next *config) string {
+	if prev == nil {
+		return "initial load"
+	}
+	var changed []string
+	if !reflect.DeepEqual(prev.Storage.Type, next.Storage.Type) ||
+		!reflect.DeepEqual(prev.Storage.DirCache, next.Storage.DirCache) ||
+		!reflect.DeepEqual(prev.Storage.Redis, next.Storage.Redis) ||
+		!reflect.DeepEqual(prev.Storage.S3, next.Storage.S3) ||
+		!reflect.DeepEqual(prev.Storage.Etcd, next.Storage.Etcd) {
+		changed = append(changed, "storage")
+	}
+	if !reflect.DeepEqual(prev.Managed, next.Managed) {
+		changed = append(changed, fmt.Sprintf("managed(%d->%d)", len(prev.Managed), len(next.Managed)))
+	}
+	if !reflect.DeepEqual(prev.Issuers, next.Issuers) {
+		changed = append(changed, "issuers")
+	}
+	if !reflect.DeepEqual(prev.LetsEncrypt.Domains, next.LetsEncrypt.Domains) ||
+		!reflect.DeepEqual(prev.LetsEncrypt.REPatterns, next.LetsEncrypt.REPatterns) ||
+		!reflect.DeepEqual(prev.LetsEncrypt.Wildcards, next.LetsEncrypt.Wildcards) {
+		changed = append(changed, "lets_encrypt domains")
+	}
+	if prev.LetsEncrypt.RenewalWindowRatio != next.LetsEncrypt.RenewalWindowRatio {
+		changed = append(changed, "renewal_window_ratio")
+	}
+	if len(changed) == 0 {
+		return "no material change"
+	}
+	return fmt.Sprintf("changed sections: %v", changed)
+}
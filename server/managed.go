@@ -3,6 +3,7 @@ package server
 import (
 	"crypto/tls"
 	"fmt"
+	"regexp"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -56,11 +57,12 @@ func (p *ManagedCertManager) getManagedCertificate(certKey string) (*tls.Certifi
 		mngCert := cached.(*managedCert)
 		tlscert := atomic.LoadPointer(&mngCert.cert)
 		if tlscert != nil {
-			if mngCert.loadAt > 0 &&
-				time.Now().Unix()-mngCert.loadAt > reloadInterval {
+			cert := (*tls.Certificate)(tlscert)
+			if (mngCert.loadAt > 0 && time.Now().Unix()-mngCert.loadAt > reloadInterval) ||
+				needsRenewal(cert, CurrentRenewalWindowRatio()) {
 				go p.reloadManagedCertificate(mngCert, certKey)
 			}
-			return (*tls.Certificate)(tlscert), nil
+			return cert, nil
 		}
 	}
 
@@ -97,3 +99,20 @@ func (p *ManagedCertManager) reloadManagedCertificate(mngCert *managedCert, cert
 func (p *ManagedCertManager) OCSPKeyName(certKey string) string {
 	return fmt.Sprintf("managed|%s", certKey)
 }
+
+// EvictRemoved drops cached entries whose certKey no longer matches any of
+// patterns, called after a config reload removes or changes a managed
+// Pattern so stale certificates aren't served past their entry's removal.
+func (p *ManagedCertManager) EvictRemoved(patterns []*regexp.Regexp) {
+	p.cache.Range(func(k, v interface{}) bool {
+		certKey := k.(string)
+		for _, re := range patterns {
+			if re.MatchString(certKey) {
+				return true
+			}
+		}
+		p.log.Infof("evicting managed certificate no longer matched by any pattern: certKey= %s", certKey)
+		p.cache.Delete(certKey)
+		return true
+	})
+}
@@ -0,0 +1,239 @@
+package server
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/jxskiss/gopkg/v2/zlog"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/ocsp"
+)
+
+// MetricsHandler serves the ssl_cert_server_ocsp_* gauges (and any other
+// metrics registered against the default Prometheus registry) for mounting
+// at "/metrics" on the admin listener.
+func MetricsHandler() http.Handler {
+	return promhttp.Handler()
+}
+
+// staple holds the last-known-good OCSP response for a certificate and
+// the schedule for refreshing it.
+type staple struct {
+	mu sync.Mutex
+
+	reload func() (*tls.Certificate, error)
+
+	raw        []byte
+	thisUpdate time.Time
+	nextUpdate time.Time
+	lastError  error
+
+	timer *time.Timer
+}
+
+// OCSPManager fetches and refreshes OCSP staples for the certificates
+// served by ManagedCertManager, with a soft-fail window: if a refresh
+// fails, the last-known-good staple keeps being served until its
+// nextUpdate actually passes, rather than dropping the staple immediately.
+type OCSPManager struct {
+	mu      sync.Mutex
+	staples map[string]*staple
+
+	httpClient *http.Client
+	log        *zap.SugaredLogger
+}
+
+func NewOCSPManager() *OCSPManager {
+	return &OCSPManager{
+		staples:    make(map[string]*staple),
+		httpClient: http.DefaultClient,
+		log:        zlog.Named("ocsp").Sugar(),
+	}
+}
+
+// Watch starts (or re-targets) the stapling refresh loop for keyName.
+// reload is called to obtain the current leaf/issuer certificate whenever
+// a refresh is due; it is the same accessor ManagedCertManager itself uses
+// to serve the certificate.
+func (p *OCSPManager) Watch(keyName string, reload func() (*tls.Certificate, error)) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if s, ok := p.staples[keyName]; ok {
+		s.mu.Lock()
+		s.reload = reload
+		s.mu.Unlock()
+		return
+	}
+	s := &staple{reload: reload}
+	p.staples[keyName] = s
+	p.scheduleNow(keyName, s)
+}
+
+// Staple returns the current cached OCSP response for keyName, or nil if
+// none is available yet or its nextUpdate has passed.
+func (p *OCSPManager) Staple(keyName string) []byte {
+	p.mu.Lock()
+	s, ok := p.staples[keyName]
+	p.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.nextUpdate.IsZero() && time.Now().After(s.nextUpdate) {
+		return nil
+	}
+	return s.raw
+}
+
+func (p *OCSPManager) scheduleNow(keyName string, s *staple) {
+	s.timer = time.AfterFunc(0, func() { p.refresh(keyName, s) })
+}
+
+// refresh fetches a new OCSP response and schedules the next refresh at
+// thisUpdate + 0.5*(nextUpdate-thisUpdate), per RFC 6960 recommended
+// practice of refreshing around the midpoint of the validity window
+// rather than waiting until it's nearly expired. On failure, it retries
+// with jitter and keeps serving the last-known-good staple until its
+// nextUpdate has actually passed (soft-fail).
+func (p *OCSPManager) refresh(keyName string, s *staple) {
+	tlscert, err := s.reload()
+	if err != nil || tlscert == nil || tlscert.Leaf == nil || len(tlscert.Certificate) < 2 {
+		p.retryAfterFailure(keyName, s, errors.New("certificate or issuer unavailable"))
+		return
+	}
+	issuer, err := x509.ParseCertificate(tlscert.Certificate[1])
+	if err != nil {
+		p.retryAfterFailure(keyName, s, err)
+		return
+	}
+
+	resp, err := fetchOCSPStaple(p.httpClient, tlscert.Leaf, issuer)
+	if err != nil {
+		p.retryAfterFailure(keyName, s, err)
+		return
+	}
+
+	s.mu.Lock()
+	s.raw = resp.Raw
+	s.thisUpdate = resp.ThisUpdate
+	s.nextUpdate = resp.NextUpdate
+	s.lastError = nil
+	s.mu.Unlock()
+
+	observeStapleStatus(keyName, resp.ThisUpdate, resp.NextUpdate, nil)
+
+	delay := midpointRefreshDelay(resp.ThisUpdate, resp.NextUpdate)
+	s.timer = time.AfterFunc(delay, func() { p.refresh(keyName, s) })
+}
+
+// midpointRefreshDelay returns how long to wait before the next refresh,
+// targeting the midpoint of [thisUpdate, nextUpdate] per RFC 6960's
+// recommended practice, rather than waiting until the staple is nearly
+// expired. If the midpoint has already passed (e.g. after a slow fetch),
+// it returns a short fixed delay instead of refreshing in a tight loop.
+func midpointRefreshDelay(thisUpdate, nextUpdate time.Time) time.Duration {
+	half := nextUpdate.Sub(thisUpdate) / 2
+	delay := time.Until(thisUpdate.Add(half))
+	if delay <= 0 {
+		delay = time.Minute
+	}
+	return delay
+}
+
+// retryAfterFailure schedules a jittered retry. If a previous staple is
+// still held and its nextUpdate hasn't passed yet, it keeps being served
+// (soft-fail); once nextUpdate has passed, Staple returns nil.
+func (p *OCSPManager) retryAfterFailure(keyName string, s *staple, err error) {
+	s.mu.Lock()
+	s.lastError = err
+	nextUpdate := s.nextUpdate
+	s.mu.Unlock()
+
+	p.log.Warnf("failed to refresh OCSP staple: certKey= %s err= %v", keyName, err)
+	observeStapleStatus(keyName, time.Time{}, nextUpdate, err)
+
+	s.timer = time.AfterFunc(jitteredRetryDelay(), func() { p.refresh(keyName, s) })
+}
+
+// jitteredRetryDelay returns a delay of 1 minute plus up to 30 seconds of
+// random jitter, so that many staples failing at once (e.g. a responder
+// outage) don't all retry in lockstep and re-hammer it.
+func jitteredRetryDelay() time.Duration {
+	return time.Minute + time.Duration(rand.Int63n(int64(30*time.Second)))
+}
+
+// observeStapleStatus updates the Prometheus gauges exposed at /metrics so
+// operators can alert on stapling failures.
+func observeStapleStatus(keyName string, thisUpdate, nextUpdate time.Time, err error) {
+	if !thisUpdate.IsZero() {
+		ocspThisUpdate.WithLabelValues(keyName).Set(float64(thisUpdate.Unix()))
+	}
+	if !nextUpdate.IsZero() {
+		ocspNextUpdate.WithLabelValues(keyName).Set(float64(nextUpdate.Unix()))
+	}
+	if err != nil {
+		ocspLastError.WithLabelValues(keyName).Set(1)
+	} else {
+		ocspLastError.WithLabelValues(keyName).Set(0)
+	}
+}
+
+var (
+	ocspThisUpdate = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "ssl_cert_server",
+		Subsystem: "ocsp",
+		Name:      "this_update_seconds",
+		Help:      "Unix timestamp of the current OCSP staple's thisUpdate field.",
+	}, []string{"cert_key"})
+
+	ocspNextUpdate = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "ssl_cert_server",
+		Subsystem: "ocsp",
+		Name:      "next_update_seconds",
+		Help:      "Unix timestamp of the current OCSP staple's nextUpdate field.",
+	}, []string{"cert_key"})
+
+	ocspLastError = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "ssl_cert_server",
+		Subsystem: "ocsp",
+		Name:      "last_refresh_failed",
+		Help:      "1 if the most recent OCSP staple refresh failed, 0 otherwise.",
+	}, []string{"cert_key"})
+)
+
+func init() {
+	prometheus.MustRegister(ocspThisUpdate, ocspNextUpdate, ocspLastError)
+}
+
+// fetchOCSPStaple builds an OCSP request for leaf/issuer, POSTs it to the
+// responder URL embedded in leaf's AuthorityInfoAccess extension, and
+// parses the response.
+func fetchOCSPStaple(client *http.Client, leaf, issuer *x509.Certificate) (*ocsp.Response, error) {
+	if len(leaf.OCSPServer) == 0 {
+		return nil, errors.New("certificate has no OCSP responder URL")
+	}
+	req, err := ocsp.CreateRequest(leaf, issuer, nil)
+	if err != nil {
+		return nil, err
+	}
+	httpResp, err := client.Post(leaf.OCSPServer[0], "application/ocsp-request", bytes.NewReader(req))
+	if err != nil {
+		return nil, err
+	}
+	defer httpResp.Body.Close()
+	body, err := io.ReadAll(httpResp.Body)
+	if err != nil {
+		return nil, err
+	}
+	return ocsp.ParseResponseForCert(body, leaf, issuer)
+}
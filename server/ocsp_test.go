@@ -0,0 +1,56 @@
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMidpointRefreshDelay(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name       string
+		thisUpdate time.Time
+		nextUpdate time.Time
+		want       time.Duration
+	}{
+		{
+			name:       "7-day validity window, refresh at the midpoint",
+			thisUpdate: now,
+			nextUpdate: now.Add(7 * 24 * time.Hour),
+			want:       7 * 24 * time.Hour / 2,
+		},
+		{
+			name:       "1-hour validity window",
+			thisUpdate: now,
+			nextUpdate: now.Add(time.Hour),
+			want:       30 * time.Minute,
+		},
+		{
+			name:       "midpoint already in the past falls back to a short fixed delay",
+			thisUpdate: now.Add(-48 * time.Hour),
+			nextUpdate: now.Add(-47 * time.Hour),
+			want:       time.Minute,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := midpointRefreshDelay(tt.thisUpdate, tt.nextUpdate)
+			diff := got - tt.want
+			if diff < 0 {
+				diff = -diff
+			}
+			if diff > time.Second {
+				t.Errorf("midpointRefreshDelay() = %v, want ~%v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJitteredRetryDelay(t *testing.T) {
+	for i := 0; i < 50; i++ {
+		got := jitteredRetryDelay()
+		if got < time.Minute || got >= time.Minute+30*time.Second {
+			t.Fatalf("jitteredRetryDelay() = %v, want in [1m, 1m30s)", got)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package server
+
+import (
+	"crypto/tls"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultRenewalWindowRatio is used when SetRenewalWindowRatio hasn't been
+// called yet (e.g. in tests), and mirrors the default used by config.go.
+const DefaultRenewalWindowRatio = 1.0 / 3
+
+// renewalWindowRatio holds the current RenewalWindowRatio, read by
+// ManagedCertManager on every certificate lookup and written on every
+// initial load and SIGHUP/`/debug/reload` reload; atomic.Value keeps that
+// safe for concurrent use without a mutex, as the atomic.Pointer in
+// reload.go's ConfigReloader does for the rest of the configuration.
+var renewalWindowRatio atomic.Value // float64
+
+// SetRenewalWindowRatio updates the fraction of a certificate's total
+// lifetime, remaining before expiry, at which ManagedCertManager treats it
+// as due for renewal. Safe for concurrent use with CurrentRenewalWindowRatio.
+func SetRenewalWindowRatio(ratio float64) {
+	renewalWindowRatio.Store(ratio)
+}
+
+// CurrentRenewalWindowRatio returns the ratio set by the most recent
+// SetRenewalWindowRatio call, or DefaultRenewalWindowRatio if it has never
+// been called.
+func CurrentRenewalWindowRatio() float64 {
+	ratio, ok := renewalWindowRatio.Load().(float64)
+	if !ok {
+		return DefaultRenewalWindowRatio
+	}
+	return ratio
+}
+
+// needsRenewal reports whether tlscert is due for renewal under the
+// percent-of-lifetime policy: due once the remaining time before expiry
+// is less than ratio of the certificate's total lifetime. This works for
+// certificates of any lifetime, unlike a fixed day count, which is
+// meaningless for short-lived certs (e.g. 6-day or 24h certs).
+func needsRenewal(tlscert *tls.Certificate, ratio float64) bool {
+	if tlscert == nil || tlscert.Leaf == nil {
+		return false
+	}
+	leaf := tlscert.Leaf
+	total := leaf.NotAfter.Sub(leaf.NotBefore)
+	if total <= 0 {
+		return false
+	}
+	remaining := time.Until(leaf.NotAfter)
+	return remaining < time.Duration(ratio*float64(total))
+}
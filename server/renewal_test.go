@@ -0,0 +1,72 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"testing"
+	"time"
+)
+
+func leafCert(notBefore, notAfter time.Time) *tls.Certificate {
+	return &tls.Certificate{Leaf: &x509.Certificate{NotBefore: notBefore, NotAfter: notAfter}}
+}
+
+func TestNeedsRenewal(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name  string
+		cert  *tls.Certificate
+		ratio float64
+		want  bool
+	}{
+		{
+			name:  "nil certificate",
+			cert:  nil,
+			ratio: 1.0 / 3,
+			want:  false,
+		},
+		{
+			name:  "nil leaf",
+			cert:  &tls.Certificate{},
+			ratio: 1.0 / 3,
+			want:  false,
+		},
+		{
+			name:  "fresh 90-day cert, well outside renewal window",
+			cert:  leafCert(now.Add(-1*time.Hour), now.Add(90*24*time.Hour)),
+			ratio: 1.0 / 3,
+			want:  false,
+		},
+		{
+			name:  "90-day cert, inside the final third of its lifetime",
+			cert:  leafCert(now.Add(-61*24*time.Hour), now.Add(29*24*time.Hour)),
+			ratio: 1.0 / 3,
+			want:  true,
+		},
+		{
+			name:  "6-day Let's Encrypt short-lived cert, past its ratio window",
+			cert:  leafCert(now.Add(-5*24*time.Hour), now.Add(1*24*time.Hour)),
+			ratio: 1.0 / 3,
+			want:  true,
+		},
+		{
+			name:  "already expired",
+			cert:  leafCert(now.Add(-2*24*time.Hour), now.Add(-1*time.Hour)),
+			ratio: 1.0 / 3,
+			want:  true,
+		},
+		{
+			name:  "zero lifetime (NotAfter == NotBefore) is never due",
+			cert:  leafCert(now, now),
+			ratio: 1.0 / 3,
+			want:  false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := needsRenewal(tt.cert, tt.ratio); got != tt.want {
+				t.Errorf("needsRenewal() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// dirCacheStorage adapts the existing dir_cache implementation (an
+// autocert.Cache plus a flock-based Locker) to the generalized Storage
+// interface.
+type dirCacheStorage struct {
+	*dirCacheLocker
+	dir   string
+	cache interface {
+		Get(ctx context.Context, key string) ([]byte, error)
+		Put(ctx context.Context, key string, data []byte) error
+		Delete(ctx context.Context, key string) error
+	}
+}
+
+func newDirCacheStorage(dir string) *dirCacheStorage {
+	cache, _ := NewDirCache(dir)
+	return &dirCacheStorage{dirCacheLocker: newDirCacheLocker(dir), dir: dir, cache: cache}
+}
+
+func (p *dirCacheStorage) Load(ctx context.Context, key string) ([]byte, error) {
+	return p.cache.Get(ctx, key)
+}
+
+func (p *dirCacheStorage) Store(ctx context.Context, key string, data []byte) error {
+	return p.cache.Put(ctx, key, data)
+}
+
+func (p *dirCacheStorage) Delete(ctx context.Context, key string) error {
+	return p.cache.Delete(ctx, key)
+}
+
+func (p *dirCacheStorage) List(ctx context.Context, prefix string) ([]string, error) {
+	entries, err := os.ReadDir(p.dir)
+	if err != nil {
+		return nil, err
+	}
+	var keys []string
+	for _, e := range entries {
+		if e.IsDir() || strings.HasSuffix(e.Name(), ".lock") {
+			continue
+		}
+		if strings.HasPrefix(e.Name(), prefix) {
+			keys = append(keys, e.Name())
+		}
+	}
+	return keys, nil
+}
+
+func (p *dirCacheStorage) Stat(ctx context.Context, key string) (StorageInfo, error) {
+	fi, err := os.Stat(filepath.Join(p.dir, key))
+	if err != nil {
+		return StorageInfo{}, err
+	}
+	return StorageInfo{Key: key, Size: fi.Size()}, nil
+}
+
+// redisStorage adapts the existing redis cache implementation plus a
+// SETNX-based Locker to the generalized Storage interface.
+type redisStorage struct {
+	*redisLocker
+	client *redis.Client
+	cache  interface {
+		Get(ctx context.Context, key string) ([]byte, error)
+		Put(ctx context.Context, key string, data []byte) error
+		Delete(ctx context.Context, key string) error
+	}
+}
+
+func newRedisStorage(addr string) (*redisStorage, error) {
+	cache, err := NewRedisCache(addr)
+	if err != nil {
+		return nil, err
+	}
+	client := redis.NewClient(&redis.Options{Addr: addr})
+	return &redisStorage{redisLocker: newRedisLocker(client), client: client, cache: cache}, nil
+}
+
+func (p *redisStorage) Load(ctx context.Context, key string) ([]byte, error) {
+	return p.cache.Get(ctx, key)
+}
+
+func (p *redisStorage) Store(ctx context.Context, key string, data []byte) error {
+	return p.cache.Put(ctx, key, data)
+}
+
+func (p *redisStorage) Delete(ctx context.Context, key string) error {
+	return p.cache.Delete(ctx, key)
+}
+
+func (p *redisStorage) List(ctx context.Context, prefix string) ([]string, error) {
+	var keys []string
+	iter := p.client.Scan(ctx, 0, prefix+"*", 0).Iterator()
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+	}
+	return keys, iter.Err()
+}
+
+func (p *redisStorage) Stat(ctx context.Context, key string) (StorageInfo, error) {
+	size, err := p.client.StrLen(ctx, key).Result()
+	if err != nil {
+		return StorageInfo{}, fmt.Errorf("redis: stat %q: %v", key, err)
+	}
+	return StorageInfo{Key: key, Size: size}, nil
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/client/v3/concurrency"
+)
+
+// EtcdConfig configures the etcd storage backend, intended for k8s-native
+// deployments that already run an etcd cluster.
+type EtcdConfig struct {
+	Endpoints []string `yaml:"endpoints"`
+	Prefix    string   `yaml:"prefix"` // default: "/ssl-cert-server/"
+	Username  string   `yaml:"username"`
+	Password  string   `yaml:"password"`
+}
+
+// etcdStorage implements Storage against an etcd v3 cluster, using
+// session-scoped mutexes (go.etcd.io/etcd/client/v3/concurrency) for
+// Locker so distributed locking survives client disconnects cleanly.
+type etcdStorage struct {
+	cfg     EtcdConfig
+	client  *clientv3.Client
+	session *concurrency.Session
+
+	mu      sync.Mutex
+	mutexes map[string]*concurrency.Mutex
+}
+
+func newEtcdStorage(cfg EtcdConfig) (*etcdStorage, error) {
+	if len(cfg.Endpoints) == 0 {
+		return nil, fmt.Errorf("etcd: endpoints is required")
+	}
+	if cfg.Prefix == "" {
+		cfg.Prefix = "/ssl-cert-server/"
+	}
+	client, err := clientv3.New(clientv3.Config{
+		Endpoints: cfg.Endpoints,
+		Username:  cfg.Username,
+		Password:  cfg.Password,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("etcd: connect: %v", err)
+	}
+	session, err := concurrency.NewSession(client)
+	if err != nil {
+		return nil, fmt.Errorf("etcd: new session: %v", err)
+	}
+	return &etcdStorage{
+		cfg:     cfg,
+		client:  client,
+		session: session,
+		mutexes: make(map[string]*concurrency.Mutex),
+	}, nil
+}
+
+func (p *etcdStorage) fullKey(key string) string {
+	return strings.TrimSuffix(p.cfg.Prefix, "/") + "/" + key
+}
+
+func (p *etcdStorage) Load(ctx context.Context, key string) ([]byte, error) {
+	resp, err := p.client.Get(ctx, p.fullKey(key))
+	if err != nil {
+		return nil, fmt.Errorf("etcd: get %q: %v", key, err)
+	}
+	if len(resp.Kvs) == 0 {
+		return nil, fmt.Errorf("etcd: key %q not found", key)
+	}
+	return resp.Kvs[0].Value, nil
+}
+
+func (p *etcdStorage) Store(ctx context.Context, key string, data []byte) error {
+	_, err := p.client.Put(ctx, p.fullKey(key), string(data))
+	if err != nil {
+		return fmt.Errorf("etcd: put %q: %v", key, err)
+	}
+	return nil
+}
+
+func (p *etcdStorage) Delete(ctx context.Context, key string) error {
+	_, err := p.client.Delete(ctx, p.fullKey(key))
+	if err != nil {
+		return fmt.Errorf("etcd: delete %q: %v", key, err)
+	}
+	return nil
+}
+
+func (p *etcdStorage) List(ctx context.Context, prefix string) ([]string, error) {
+	resp, err := p.client.Get(ctx, p.fullKey(prefix), clientv3.WithPrefix())
+	if err != nil {
+		return nil, fmt.Errorf("etcd: list %q: %v", prefix, err)
+	}
+	keys := make([]string, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		keys = append(keys, strings.TrimPrefix(string(kv.Key), p.cfg.Prefix))
+	}
+	return keys, nil
+}
+
+func (p *etcdStorage) Stat(ctx context.Context, key string) (StorageInfo, error) {
+	resp, err := p.client.Get(ctx, p.fullKey(key))
+	if err != nil {
+		return StorageInfo{}, fmt.Errorf("etcd: stat %q: %v", key, err)
+	}
+	if len(resp.Kvs) == 0 {
+		return StorageInfo{}, fmt.Errorf("etcd: key %q not found", key)
+	}
+	return StorageInfo{Key: key, Size: int64(len(resp.Kvs[0].Value))}, nil
+}
+
+func (p *etcdStorage) Lock(ctx context.Context, key string) error {
+	m := concurrency.NewMutex(p.session, p.fullKey(key)+".lock")
+	if err := m.Lock(ctx); err != nil {
+		return fmt.Errorf("etcd: lock %q: %v", key, err)
+	}
+	p.mu.Lock()
+	p.mutexes[key] = m
+	p.mu.Unlock()
+	return nil
+}
+
+func (p *etcdStorage) Unlock(key string) error {
+	p.mu.Lock()
+	m, ok := p.mutexes[key]
+	if ok {
+		delete(p.mutexes, key)
+	}
+	p.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("etcd: key %q is not locked", key)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := m.Unlock(ctx); err != nil {
+		return fmt.Errorf("etcd: unlock %q: %v", key, err)
+	}
+	return nil
+}
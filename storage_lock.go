@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"golang.org/x/sys/unix"
+)
+
+// Locker coordinates certificate issuance across multiple ssl-cert-server
+// instances sharing the same storage backend, so that when N instances
+// share the same Redis or an NFS-mounted dir_cache, only one of them
+// performs the ACME order for a given domain while the others block and
+// then read the freshly-written certificate.
+type Locker interface {
+	// Lock blocks until the lock for key is acquired or ctx is done.
+	Lock(ctx context.Context, key string) error
+
+	// Unlock releases a lock previously acquired with Lock. It must be
+	// safe to call from the same process/goroutine that called Lock.
+	Unlock(key string) error
+}
+
+// withLock runs fn while holding the lock for key, releasing it
+// afterwards regardless of fn's outcome. When locker is nil (single
+// instance deployments with no distributed storage configured), fn runs
+// unlocked.
+func withLock(ctx context.Context, locker Locker, key string, fn func() error) error {
+	if locker == nil {
+		return fn()
+	}
+	if err := locker.Lock(ctx, key); err != nil {
+		return fmt.Errorf("storage: acquire lock for %q: %v", key, err)
+	}
+	defer func() {
+		if err := locker.Unlock(key); err != nil {
+			log.Printf("[WARN] server: failed to release lock for %q: %v", key, err)
+		}
+	}()
+	return fn()
+}
+
+// dirCacheLocker implements Locker for the dir_cache backend using
+// flock(2) on a ".lock" sibling file, which works correctly even when the
+// directory is NFS-mounted and shared between instances.
+type dirCacheLocker struct {
+	dir string
+
+	mu    sync.Mutex
+	files map[string]*os.File
+}
+
+func newDirCacheLocker(dir string) *dirCacheLocker {
+	return &dirCacheLocker{dir: dir, files: make(map[string]*os.File)}
+}
+
+func (p *dirCacheLocker) lockPath(key string) string {
+	return filepath.Join(p.dir, key+".lock")
+}
+
+func (p *dirCacheLocker) Lock(ctx context.Context, key string) error {
+	f, err := os.OpenFile(p.lockPath(key), os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return err
+	}
+	done := make(chan error, 1)
+	go func() { done <- unix.Flock(int(f.Fd()), unix.LOCK_EX) }()
+	select {
+	case err := <-done:
+		if err != nil {
+			f.Close()
+			return err
+		}
+		p.mu.Lock()
+		p.files[key] = f
+		p.mu.Unlock()
+		return nil
+	case <-ctx.Done():
+		f.Close()
+		return ctx.Err()
+	}
+}
+
+func (p *dirCacheLocker) Unlock(key string) error {
+	p.mu.Lock()
+	f, ok := p.files[key]
+	if ok {
+		delete(p.files, key)
+	}
+	p.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("dir_cache: key %q is not locked", key)
+	}
+	defer f.Close()
+	return unix.Flock(int(f.Fd()), unix.LOCK_UN)
+}
+
+// redisLocker implements Locker against Redis using Redlock-style SETNX
+// with an expiry, refreshed by a background fencing-token holder so a
+// long-running ACME order doesn't lose the lock mid-flight.
+type redisLocker struct {
+	client *redis.Client
+	ttl    time.Duration
+
+	mu     sync.Mutex
+	tokens map[string]string
+}
+
+// unlockScript atomically checks that the lock at KEYS[1] is still held by
+// the token in ARGV[1] before deleting it, so a lock that expired and was
+// re-acquired by a different instance between our GET and DEL is never
+// stolen out from under its new owner.
+var unlockScript = redis.NewScript(`
+if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("del", KEYS[1])
+else
+	return 0
+end
+`)
+
+func newRedisLocker(client *redis.Client) *redisLocker {
+	return &redisLocker{client: client, ttl: 30 * time.Second, tokens: make(map[string]string)}
+}
+
+func (p *redisLocker) lockKey(key string) string {
+	return "ssl-cert-server:lock:" + key
+}
+
+func (p *redisLocker) Lock(ctx context.Context, key string) error {
+	token := fmt.Sprintf("%d", time.Now().UnixNano())
+	lockKey := p.lockKey(key)
+	for {
+		ok, err := p.client.SetNX(ctx, lockKey, token, p.ttl).Result()
+		if err != nil {
+			return err
+		}
+		if ok {
+			p.mu.Lock()
+			p.tokens[key] = token
+			p.mu.Unlock()
+			go p.refresh(ctx, lockKey, token)
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(500 * time.Millisecond):
+		}
+	}
+}
+
+// refresh extends the lock's expiry periodically while it is held, so a
+// single-node outage does not let the lock expire mid-issuance.
+func (p *redisLocker) refresh(ctx context.Context, lockKey, token string) {
+	ticker := time.NewTicker(p.ttl / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			cur, err := p.client.Get(ctx, lockKey).Result()
+			if err != nil || cur != token {
+				return
+			}
+			p.client.Expire(ctx, lockKey, p.ttl)
+		}
+	}
+}
+
+func (p *redisLocker) Unlock(key string) error {
+	p.mu.Lock()
+	token, ok := p.tokens[key]
+	if ok {
+		delete(p.tokens, key)
+	}
+	p.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("redis: key %q is not locked", key)
+	}
+	lockKey := p.lockKey(key)
+	// The script returns 0 without deleting anything when the lock has
+	// already expired and been re-acquired by a different instance; that
+	// is not an error, it just means there's nothing left for us to
+	// release.
+	return unlockScript.Run(context.Background(), p.client, []string{lockKey}, token).Err()
+}
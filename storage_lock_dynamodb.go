@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// dynamoDBLocker implements Locker against a DynamoDB table using
+// conditional writes, giving the s3 storage backend real cross-instance
+// coordination: PutItem with attribute_not_exists(lock_key) only succeeds
+// if nobody else holds the lock, and Unlock deletes conditioned on owner
+// still matching, so an expired-then-reacquired lock is never stolen from
+// its new owner. The table needs only a string partition key "lock_key".
+type dynamoDBLocker struct {
+	client *dynamodb.Client
+	table  string
+	ttl    time.Duration
+	owner  string
+}
+
+func newDynamoDBLocker(region, table string) *dynamoDBLocker {
+	return &dynamoDBLocker{
+		client: dynamodb.New(dynamodb.Options{Region: region}),
+		table:  table,
+		ttl:    30 * time.Second,
+		owner:  fmt.Sprintf("%d", time.Now().UnixNano()),
+	}
+}
+
+func (p *dynamoDBLocker) Lock(ctx context.Context, key string) error {
+	item := map[string]types.AttributeValue{
+		"lock_key":    &types.AttributeValueMemberS{Value: key},
+		"owner":       &types.AttributeValueMemberS{Value: p.owner},
+		"expire_unix": &types.AttributeValueMemberN{Value: fmt.Sprintf("%d", time.Now().Add(p.ttl).Unix())},
+	}
+	for {
+		_, err := p.client.PutItem(ctx, &dynamodb.PutItemInput{
+			TableName:           aws.String(p.table),
+			Item:                item,
+			ConditionExpression: aws.String("attribute_not_exists(lock_key) OR expire_unix < :now"),
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":now": &types.AttributeValueMemberN{Value: fmt.Sprintf("%d", time.Now().Unix())},
+			},
+		})
+		if err == nil {
+			return nil
+		}
+		var condFailed *types.ConditionalCheckFailedException
+		if !errors.As(err, &condFailed) {
+			return fmt.Errorf("dynamodb: lock %q: %v", key, err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(500 * time.Millisecond):
+		}
+	}
+}
+
+func (p *dynamoDBLocker) Unlock(key string) error {
+	_, err := p.client.DeleteItem(context.Background(), &dynamodb.DeleteItemInput{
+		TableName:           aws.String(p.table),
+		Key:                 map[string]types.AttributeValue{"lock_key": &types.AttributeValueMemberS{Value: key}},
+		ConditionExpression: aws.String("#owner = :owner"),
+		// "owner" is a DynamoDB reserved word, so it is referenced
+		// through an expression attribute name.
+		ExpressionAttributeNames: map[string]string{"#owner": "owner"},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":owner": &types.AttributeValueMemberS{Value: p.owner},
+		},
+	})
+	var condFailed *types.ConditionalCheckFailedException
+	if err != nil && !errors.As(err, &condFailed) {
+		return fmt.Errorf("dynamodb: unlock %q: %v", key, err)
+	}
+	// A condition failure here means the lock already expired and was
+	// re-acquired by a different instance; nothing left for us to release.
+	return nil
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	kmstypes "github.com/aws/aws-sdk-go-v2/service/kms/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// S3Config configures the s3 storage backend.
+type S3Config struct {
+	Bucket   string `yaml:"bucket"`
+	Region   string `yaml:"region"`
+	Prefix   string `yaml:"prefix"`
+	KMSKeyID string `yaml:"kms_key_id"` // when set, private-key objects are envelope-encrypted with this KMS key
+
+	// LockTable, when set, names a DynamoDB table (single string partition
+	// key "lock_key") used to coordinate issuance across instances sharing
+	// this bucket. S3 has no native locking primitive of its own, so
+	// without LockTable, multiple instances pointed at the same bucket can
+	// race to issue the same certificate; that's fine for a single
+	// instance, but for true HA deployments LockTable should be set.
+	LockTable string `yaml:"lock_table"`
+}
+
+// s3Storage implements Storage against an S3-compatible object store.
+// When cfg.KMSKeyID is set, private-key values (see isPrivateKeyObject)
+// are envelope-encrypted: a per-object data key is generated via KMS
+// GenerateDataKey, used to encrypt the payload locally, and the
+// KMS-wrapped data key is stored alongside the ciphertext. Other values
+// are stored as-is.
+type s3Storage struct {
+	cfg       S3Config
+	s3Client  *s3.Client
+	kmsClient *kms.Client
+	locker    Locker
+}
+
+func newS3Storage(cfg S3Config) (*s3Storage, error) {
+	if cfg.Bucket == "" {
+		return nil, fmt.Errorf("s3: bucket is required")
+	}
+	s3Client := s3.New(s3.Options{Region: cfg.Region})
+	var kmsClient *kms.Client
+	if cfg.KMSKeyID != "" {
+		kmsClient = kms.New(kms.Options{Region: cfg.Region})
+	}
+
+	// S3 has no native locking primitive; conditional writes
+	// (If-None-Match) would require S3 Object Lock, which isn't
+	// universally available across S3-compatible providers, so
+	// distributed locking goes through DynamoDB instead when LockTable is
+	// configured. Falling back to noopLocker without LockTable is only
+	// safe for a single instance; warn loudly so operators running
+	// multiple instances against shared S3 storage notice the gap rather
+	// than silently racing each other's ACME orders.
+	var locker Locker = noopLocker{}
+	if cfg.LockTable != "" {
+		locker = newDynamoDBLocker(cfg.Region, cfg.LockTable)
+	} else {
+		log.Printf("[WARN] server: storage.s3.lock_table is not set; certificate issuance is NOT coordinated across instances sharing this bucket")
+	}
+
+	return &s3Storage{
+		cfg:       cfg,
+		s3Client:  s3Client,
+		kmsClient: kmsClient,
+		locker:    locker,
+	}, nil
+}
+
+func (p *s3Storage) objectKey(key string) string {
+	if p.cfg.Prefix == "" {
+		return key
+	}
+	return strings.TrimSuffix(p.cfg.Prefix, "/") + "/" + key
+}
+
+func (p *s3Storage) Load(ctx context.Context, key string) ([]byte, error) {
+	out, err := p.s3Client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(p.cfg.Bucket),
+		Key:    aws.String(p.objectKey(key)),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("s3: get %q: %v", key, err)
+	}
+	defer out.Body.Close()
+	data, err := io.ReadAll(out.Body)
+	if err != nil {
+		return nil, err
+	}
+	if p.kmsClient != nil && isPrivateKeyObject(key) {
+		return p.decryptEnvelope(ctx, data)
+	}
+	return data, nil
+}
+
+func (p *s3Storage) Store(ctx context.Context, key string, data []byte) error {
+	if p.kmsClient != nil && isPrivateKeyObject(key) {
+		enc, err := p.encryptEnvelope(ctx, data)
+		if err != nil {
+			return err
+		}
+		data = enc
+	}
+	_, err := p.s3Client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(p.cfg.Bucket),
+		Key:    aws.String(p.objectKey(key)),
+		Body:   bytes.NewReader(data),
+	})
+	if err != nil {
+		return fmt.Errorf("s3: put %q: %v", key, err)
+	}
+	return nil
+}
+
+func (p *s3Storage) Delete(ctx context.Context, key string) error {
+	_, err := p.s3Client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(p.cfg.Bucket),
+		Key:    aws.String(p.objectKey(key)),
+	})
+	if err != nil {
+		return fmt.Errorf("s3: delete %q: %v", key, err)
+	}
+	return nil
+}
+
+func (p *s3Storage) List(ctx context.Context, prefix string) ([]string, error) {
+	out, err := p.s3Client.ListObjectsV2(ctx, &s3.ListObjectsV2Input{
+		Bucket: aws.String(p.cfg.Bucket),
+		Prefix: aws.String(p.objectKey(prefix)),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("s3: list %q: %v", prefix, err)
+	}
+	keys := make([]string, 0, len(out.Contents))
+	for _, obj := range out.Contents {
+		keys = append(keys, strings.TrimPrefix(aws.ToString(obj.Key), p.cfg.Prefix+"/"))
+	}
+	return keys, nil
+}
+
+func (p *s3Storage) Stat(ctx context.Context, key string) (StorageInfo, error) {
+	out, err := p.s3Client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(p.cfg.Bucket),
+		Key:    aws.String(p.objectKey(key)),
+	})
+	if err != nil {
+		return StorageInfo{}, fmt.Errorf("s3: stat %q: %v", key, err)
+	}
+	return StorageInfo{Key: key, Size: aws.ToInt64(out.ContentLength)}, nil
+}
+
+func (p *s3Storage) Lock(ctx context.Context, key string) error { return p.locker.Lock(ctx, key) }
+func (p *s3Storage) Unlock(key string) error                    { return p.locker.Unlock(key) }
+
+// isPrivateKeyObject reports whether key stores private-key bytes, which
+// get envelope-encrypted when a KMS key is configured; everything else
+// (certificates, ACME account metadata) is plaintext in the bucket.
+func isPrivateKeyObject(key string) bool {
+	return strings.HasSuffix(key, ".key") || strings.Contains(key, "priv_key")
+}
+
+// encryptEnvelope implements SSE-KMS-style envelope encryption: a fresh
+// AES-256 data key is requested from KMS, used once to seal plaintext
+// with AES-GCM, then discarded; only the KMS-wrapped copy of the data key
+// is persisted, prefixed with its length so decryptEnvelope can split it
+// back out.
+func (p *s3Storage) encryptEnvelope(ctx context.Context, plaintext []byte) ([]byte, error) {
+	dk, err := p.kmsClient.GenerateDataKey(ctx, &kms.GenerateDataKeyInput{
+		KeyId:   aws.String(p.cfg.KMSKeyID),
+		KeySpec: kmstypes.DataKeySpecAes256,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("s3: kms generate data key: %v", err)
+	}
+	defer zeroBytes(dk.Plaintext)
+
+	block, err := aes.NewCipher(dk.Plaintext)
+	if err != nil {
+		return nil, fmt.Errorf("s3: kms envelope: %v", err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("s3: kms envelope: %v", err)
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("s3: kms envelope: %v", err)
+	}
+	sealed := gcm.Seal(nonce, nonce, plaintext, nil)
+
+	var out bytes.Buffer
+	var lenBuf [4]byte
+	binary.BigEndian.PutUint32(lenBuf[:], uint32(len(dk.CiphertextBlob)))
+	out.Write(lenBuf[:])
+	out.Write(dk.CiphertextBlob)
+	out.Write(sealed)
+	return out.Bytes(), nil
+}
+
+func (p *s3Storage) decryptEnvelope(ctx context.Context, data []byte) ([]byte, error) {
+	if len(data) < 4 {
+		return nil, fmt.Errorf("s3: kms envelope: truncated object")
+	}
+	wrappedLen := binary.BigEndian.Uint32(data[:4])
+	data = data[4:]
+	if uint32(len(data)) < wrappedLen {
+		return nil, fmt.Errorf("s3: kms envelope: truncated object")
+	}
+	wrappedKey, sealed := data[:wrappedLen], data[wrappedLen:]
+
+	dk, err := p.kmsClient.Decrypt(ctx, &kms.DecryptInput{
+		KeyId:          aws.String(p.cfg.KMSKeyID),
+		CiphertextBlob: wrappedKey,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("s3: kms decrypt data key: %v", err)
+	}
+	defer zeroBytes(dk.Plaintext)
+
+	block, err := aes.NewCipher(dk.Plaintext)
+	if err != nil {
+		return nil, fmt.Errorf("s3: kms envelope: %v", err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("s3: kms envelope: %v", err)
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, fmt.Errorf("s3: kms envelope: truncated ciphertext")
+	}
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, ciphertext, nil)
+}
+
+func zeroBytes(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
+
+// noopLocker is used where a backend has no native distributed-locking
+// primitive; Lock/Unlock succeed immediately, i.e. no coordination.
+type noopLocker struct{}
+
+func (noopLocker) Lock(ctx context.Context, key string) error { return nil }
+func (noopLocker) Unlock(key string) error                    { return nil }